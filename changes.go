@@ -0,0 +1,194 @@
+package configmanager
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/1broseidon/configmanager/internal"
+)
+
+// ChangeType classifies a single key change.
+type ChangeType int
+
+// The kinds of change reported in a ChangeEvent.
+const (
+	ChangeAdded ChangeType = iota
+	ChangeModified
+	ChangeRemoved
+)
+
+// String returns the name of the change type.
+func (ct ChangeType) String() string {
+	switch ct {
+	case ChangeAdded:
+		return "added"
+	case ChangeModified:
+		return "modified"
+	case ChangeRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// Change describes how the merged value of a single flattened key changed.
+// Old is nil for added keys and New is nil for removed keys. Each subscriber
+// gets its own deep copies of Old and New, which it may modify.
+type Change struct {
+	Key  string
+	Type ChangeType
+	Old  interface{}
+	New  interface{}
+}
+
+// ChangeEvent is delivered to subscribers registered with OnChange.
+type ChangeEvent struct {
+	// Source is the name of the layer whose update caused the change.
+	Source string
+	// Changes lists the changed keys matching the subscriber's prefix, sorted by key.
+	Changes []Change
+}
+
+// Subscription is a handle returned by OnChange.
+type Subscription struct {
+	cm     *ConfigManager
+	id     uint64
+	prefix string
+	fn     func(ChangeEvent)
+
+	mu     sync.Mutex
+	queue  []ChangeEvent
+	notify chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// OnChange registers fn to be called whenever a key under prefix changes,
+// whatever the cause: UpdateKey, a file load or reload, environment variables or
+// any other layer update. A prefix of "database" (or "database.*") matches
+// "database" itself and every "database.*" key; an empty prefix matches every key.
+//
+// Events are delivered in order on a goroutine owned by the subscription, so a
+// slow callback never blocks writers or other subscribers.
+func (cm *ConfigManager) OnChange(prefix string, fn func(ChangeEvent)) *Subscription {
+	cm.subMu.Lock()
+	defer cm.subMu.Unlock()
+
+	cm.subSeq++
+	sub := &Subscription{
+		cm:     cm,
+		id:     cm.subSeq,
+		prefix: cm.normalize(strings.TrimSuffix(strings.TrimSuffix(prefix, "*"), cm.delim)),
+		fn:     fn,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	if cm.subs == nil {
+		cm.subs = make(map[uint64]*Subscription)
+	}
+	cm.subs[sub.id] = sub
+	go sub.run()
+	return sub
+}
+
+// Unsubscribe stops delivery to the subscription. Events that have not been delivered yet are dropped.
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.cm.subMu.Lock()
+		delete(s.cm.subs, s.id)
+		s.cm.subMu.Unlock()
+		close(s.done)
+	})
+}
+
+// matches reports whether key falls under the subscription's prefix.
+func (s *Subscription) matches(key string) bool {
+	return s.prefix == "" || key == s.prefix || strings.HasPrefix(key, s.prefix+s.cm.delim)
+}
+
+// enqueue queues ev for delivery without blocking.
+func (s *Subscription) enqueue(ev ChangeEvent) {
+	s.mu.Lock()
+	s.queue = append(s.queue, ev)
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers queued events until the subscription is cancelled.
+func (s *Subscription) run() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.notify:
+		}
+
+		s.mu.Lock()
+		events := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+
+		for _, ev := range events {
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.fn(ev)
+		}
+	}
+}
+
+// publish computes the changes between two merged views and queues them for every matching subscriber.
+func (cm *ConfigManager) publish(source string, oldData, newData map[string]interface{}) {
+	cm.subMu.Lock()
+	defer cm.subMu.Unlock()
+
+	if len(cm.subs) == 0 {
+		return
+	}
+	changes := diff(oldData, newData)
+	if len(changes) == 0 {
+		return
+	}
+
+	for _, sub := range cm.subs {
+		var matched []Change
+		for _, c := range changes {
+			if sub.matches(c.Key) {
+				c.Old, c.New = internal.Copy(c.Old), internal.Copy(c.New)
+				matched = append(matched, c)
+			}
+		}
+		if len(matched) > 0 {
+			sub.enqueue(ChangeEvent{Source: source, Changes: matched})
+		}
+	}
+}
+
+// diff returns the changes between two flattened maps, sorted by key.
+func diff(oldData, newData map[string]interface{}) []Change {
+	var changes []Change
+	for k, newValue := range newData {
+		oldValue, ok := oldData[k]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Key: k, Type: ChangeAdded, New: newValue})
+		case !reflect.DeepEqual(oldValue, newValue):
+			changes = append(changes, Change{Key: k, Type: ChangeModified, Old: oldValue, New: newValue})
+		}
+	}
+	for k, oldValue := range oldData {
+		if _, ok := newData[k]; !ok {
+			changes = append(changes, Change{Key: k, Type: ChangeRemoved, Old: oldValue})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
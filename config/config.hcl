@@ -0,0 +1,24 @@
+# Ops tool settings
+region = "eu-west-1"
+debug  = true
+
+database {
+  host = "localhost"
+  port = 5432
+  pool {
+    size = 10
+  }
+}
+
+service "web" {
+  port    = 80
+  ratio   = 0.5
+  aliases = ["www", "app"]
+}
+
+service "api" {
+  port = 8080
+  tags = {
+    team = "core"
+  }
+}
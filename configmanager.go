@@ -1,18 +1,18 @@
 package configmanager
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"os"
-	"path/filepath"
-	"strings"
+	"sort"
 	"sync"
+	"sync/atomic"
 
+	"github.com/1broseidon/configmanager/formats"
 	"github.com/1broseidon/configmanager/internal"
-	"github.com/BurntSushi/toml"
-	"gopkg.in/ini.v1"
-	"gopkg.in/yaml.v2"
 )
 
 // ConfigLoader interface represents the ability to load configuration data.
@@ -26,159 +26,440 @@ type ConfigSaver interface {
 	Save() ([]byte, error)
 }
 
+// BlockLabeler is implemented by loaders whose documents have labeled blocks,
+// such as HCL. Labels reports how many labels the blocks at each key of the
+// most recently loaded document have, with key segments joined by dots, so that
+// saving writes those blocks back with their labels.
+type BlockLabeler interface {
+	Labels() map[string]int
+}
+
 // ConfigManager is the primary struct for managing configuration data.
+// Data is held in named layers (defaults, files, environment, flags and runtime
+// overrides) which are merged by priority into an immutable snapshot. Reads use
+// the current snapshot without locking; writes are serialised by mu and publish
+// a new snapshot.
 type ConfigManager struct {
-	data map[string]interface{}
-	mu   sync.RWMutex
+	snap   atomic.Pointer[snapshot]
+	layers map[string]*layer
+	seq    uint64
+	mu     sync.RWMutex
+
+	validators    []Validator
+	lastReloadErr error
+	logger        *slog.Logger
+
+	// delim, envPrefix, strict, defaultFormat and indexArrays are set by options and never change afterwards.
+	delim         string
+	envPrefix     string
+	strict        bool
+	defaultFormat string
+	indexArrays   bool
+	// defaults holds the WithDefaults data until New installs it.
+	defaults map[string]interface{}
+
+	// editMode makes SaveToFile patch existing files rather than rewrite them,
+	// and editFallback lets it rewrite files that cannot be patched.
+	editMode     bool
+	editFallback bool
+	// backups is the number of rotated backups SaveToFile keeps.
+	backups int
+
+	// anonymous numbers the layers of sources without a name, such as byte slices.
+	anonymous uint64
+
+	subs   map[uint64]*Subscription
+	subSeq uint64
+	subMu  sync.Mutex
 }
 
-// New creates a new instance of ConfigManager.
-func New() *ConfigManager {
-	return &ConfigManager{
-		data: make(map[string]interface{}),
+// New creates a new instance of ConfigManager, configured by opts.
+func New(opts ...Option) *ConfigManager {
+	cm := &ConfigManager{
+		layers: make(map[string]*layer),
+		logger: slog.New(discardHandler{}),
+		delim:  internal.DefaultDelimiter,
 	}
+	for _, opt := range opts {
+		opt(cm)
+	}
+	if cm.defaults != nil {
+		// There are no validators yet, so the defaults cannot be rejected.
+		_ = cm.SetDefaults(cm.defaults)
+		cm.defaults = nil
+	}
+	return cm
 }
 
-// GetData retrieves the configuration data from ConfigManager.
+// GetData retrieves a deep copy of the merged configuration data from ConfigManager.
+// Modifying the returned map, or the slices and maps it holds, does not affect the
+// configuration; use UpdateKey instead.
 func (cm *ConfigManager) GetData() map[string]interface{} {
-	cm.mu.RLock()
-	defer cm.mu.RUnlock()
-	return cm.data
+	return cm.current().copyData()
 }
 
 // LoadFromFile loads configuration data from a file, using DynamicConfig by default if no config loader is provided.
+// The file is registered as a layer named after filename; loading the same file again replaces that layer, while
+// files loaded later take precedence over files loaded earlier.
 func (cm *ConfigManager) LoadFromFile(filename string, config ...ConfigLoader) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
-	var loader ConfigLoader
-	if len(config) > 0 {
-		loader = config[0]
-	} else {
-		loader = &DynamicConfig{Filename: filename}
+	file, err := os.ReadFile(filename)
+	if err != nil {
+		cm.lastReloadErr = fmt.Errorf("failed to read file %s: %w", filename, err)
+		cm.logger.Error("failed to read configuration", "file", filename, "error", err)
+		return cm.lastReloadErr
 	}
 
-	file, err := os.ReadFile(filename)
+	loader := loaderOrDefault(config, &DynamicConfig{Filename: filename})
+	return cm.loadLayer(&layer{name: filename, filename: filename}, loader, file)
+}
+
+// LoadFromFS loads configuration data from path within fsys, such as an embed.FS, using DynamicConfig by default
+// if no config loader is provided. The data is registered as a layer named after path.
+func (cm *ConfigManager) LoadFromFS(fsys fs.FS, path string, config ...ConfigLoader) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	file, err := fs.ReadFile(fsys, path)
 	if err != nil {
-		return fmt.Errorf("failed to read file %s: %w", filename, err)
+		cm.lastReloadErr = fmt.Errorf("failed to read file %s: %w", path, err)
+		cm.logger.Error("failed to read configuration", "file", path, "error", err)
+		return cm.lastReloadErr
+	}
+
+	loader := loaderOrDefault(config, &DynamicConfig{Filename: path})
+	return cm.loadLayer(&layer{name: path, filename: path, fromFS: true}, loader, file)
+}
+
+// LoadFromReader loads configuration data from r, using a DynamicConfig for format by default if no config loader is
+// provided. The format may be a format name such as "yaml", a file extension or a MIME type; if it is empty the format
+// is detected from the content. Each call registers a new layer that takes precedence over previously loaded sources.
+func (cm *ConfigManager) LoadFromReader(r io.Reader, format string, config ...ConfigLoader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration: %w", err)
+	}
+	return cm.LoadFromBytes(data, format, config...)
+}
+
+// LoadFromBytes loads configuration data from data. See LoadFromReader.
+func (cm *ConfigManager) LoadFromBytes(data []byte, format string, config ...ConfigLoader) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.anonymous++
+	loader := loaderOrDefault(config, &DynamicConfig{Format: format})
+	return cm.loadLayer(&layer{name: fmt.Sprintf("bytes-%d", cm.anonymous)}, loader, data)
+}
+
+// loaderOrDefault returns the loader passed to a variadic Load method, or def if none was passed.
+func loaderOrDefault(config []ConfigLoader, def ConfigLoader) ConfigLoader {
+	if len(config) > 0 {
+		return config[0]
+	}
+	return def
+}
+
+// prepare applies the manager's delimiter, default format and array indexing to
+// a DynamicConfig loader or saver that does not set its own.
+func (cm *ConfigManager) prepare(loader interface{}) {
+	if dc, ok := loader.(*DynamicConfig); ok {
+		if dc.Delimiter == "" {
+			dc.Delimiter = cm.delim
+		}
+		if dc.DefaultFormat == "" {
+			dc.DefaultFormat = cm.defaultFormat
+		}
+		if cm.indexArrays {
+			dc.IndexArrays = true
+		}
+	}
+}
+
+// loaderData returns the data held by loader flattened with the manager's
+// delimiter, and the keys of the arrays it stores element by element. Loaders
+// other than DynamicConfig flatten keys with dots, so their keys are split again
+// when another delimiter is configured.
+func (cm *ConfigManager) loaderData(loader ConfigLoader) (map[string]interface{}, map[string]bool, error) {
+	data := internal.CopyMap(loader.GetData())
+	f := cm.listFlattener()
+	delim := loaderDelimiter(loader)
+	if dc, ok := loader.(*DynamicConfig); ok {
+		for k := range dc.lists {
+			f.Lists[internal.JoinSegments(internal.SplitKey(k, delim), cm.delim)] = true
+		}
+	}
+	if delim != cm.delim {
+		// A key may both hold a value and have keys below it, as in a
+		// properties file, so sections keep their values while rekeying.
+		f.SectionValues = true
+		nested, err := internal.Flattener{Delim: delim, SectionValues: true}.Unflatten(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		return f.Flatten(nested), f.Lists, nil
+	}
+	return f.FlattenPaths(data), f.Lists, nil
+}
+
+// labels returns the block labels recorded by the loaders of the layers,
+// so that saving writes labeled HCL blocks back with their labels. The caller
+// must hold cm.mu.
+func (cm *ConfigManager) labels() map[string]int {
+	var labels map[string]int
+	for _, l := range cm.orderedLayers() {
+		labeler, ok := l.loader.(BlockLabeler)
+		if !ok {
+			continue
+		}
+		for k, n := range labeler.Labels() {
+			if labels == nil {
+				labels = make(map[string]int)
+			}
+			labels[k] = n
+		}
+	}
+	return labels
+}
+
+// flattener returns the Flattener for the manager's delimiter and array indexing.
+func (cm *ConfigManager) flattener() internal.Flattener {
+	return internal.Flattener{Delim: cm.delim, IndexArrays: cm.indexArrays}
+}
+
+// listFlattener returns a flattener that records the arrays it flattens.
+func (cm *ConfigManager) listFlattener() internal.Flattener {
+	f := cm.flattener()
+	f.Lists = make(map[string]bool)
+	return f
+}
+
+// loaderDelimiter returns the delimiter with which loader flattens its keys.
+func loaderDelimiter(loader ConfigLoader) string {
+	if dc, ok := loader.(*DynamicConfig); ok {
+		return dc.delimiter()
 	}
+	return internal.DefaultDelimiter
+}
 
-	err = loader.Load(file)
+// loadLayer parses data with loader and registers the result as the file-priority
+// layer l, recording the outcome as the last reload error. The caller must hold cm.mu.
+func (cm *ConfigManager) loadLayer(l *layer, loader ConfigLoader, data []byte) error {
+	cm.lastReloadErr = nil
+	cm.prepare(loader)
+	if err := loader.Load(data); err != nil {
+		cm.lastReloadErr = fmt.Errorf("unsupported data format or failed to parse data: %w", err)
+		cm.logger.Error("failed to parse configuration", "source", l.name, "error", err)
+		return cm.lastReloadErr
+	}
+
+	loaded, lists, err := cm.loaderData(loader)
 	if err != nil {
-		return fmt.Errorf("unsupported data format or failed to parse data: %w", err)
+		cm.lastReloadErr = fmt.Errorf("failed to read configuration from %s: %w", l.name, err)
+		cm.logger.Error("failed to read configuration", "source", l.name, "error", err)
+		return cm.lastReloadErr
 	}
 
-	cm.data = internal.Flatten(loader.GetData())
+	l.priority = PriorityFile
+	l.data = loaded
+	l.lists = lists
+	l.loader = loader
+	l.lines = cm.keyLines(loader, l.data)
+	if cm.lastReloadErr = cm.setLayer(l); cm.lastReloadErr != nil {
+		return cm.lastReloadErr
+	}
+	cm.logger.Info("loaded configuration", "source", l.name, "keys", len(l.data))
 	return nil
 }
 
 // SaveToFile saves configuration data to a file, using DynamicConfig by default if no config saver is provided.
+// The file is replaced atomically, keeping its permissions, so a crash never leaves it partially written.
+// In edit mode the existing file is patched by the default saver rather than rewritten; see SetEditMode and
+// SetEditFallback.
 func (cm *ConfigManager) SaveToFile(filename string, config ...ConfigSaver) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
-	var saver ConfigSaver
-	if len(config) > 0 {
-		saver = config[0]
-		// Update the config's data with the current ConfigManager data
-		if loader, ok := saver.(ConfigLoader); ok {
-			unflattenedData := internal.Unflatten(cm.data)
-			unflattenedBytes, err := serializeData(filename, unflattenedData)
-			if err != nil {
-				return err
-			}
-			if err := loader.Load(unflattenedBytes); err != nil {
-				return fmt.Errorf("failed to update the config's data: %w", err)
-			}
+	dc := &DynamicConfig{Filename: filename, format: cm.fileFormat(filename)}
+	if cm.editMode {
+		original, err := os.ReadFile(filename)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to read file %s: %w", filename, err)
 		}
-	} else {
-		saver = &DynamicConfig{Data: internal.Unflatten(cm.data), Filename: filename}
+		dc.Original = original
+		dc.Rewrite = cm.editFallback
 	}
 
-	data, err := saver.Save()
+	data, err := cm.save(dc, config)
 	if err != nil {
+		cm.logger.Error("failed to save configuration", "file", filename, "error", err)
 		return fmt.Errorf("failed to save configuration to file %s: %w", filename, err)
 	}
-
-	// Debug: Print the data to be saved
-	fmt.Printf("Saving Data to File: %s - Data: %s\n", filename, string(data))
+	if dc.rewritten != nil {
+		cm.logger.Warn("rewrote configuration that could not be edited in place", "file", filename, "error", dc.rewritten)
+	}
 
 	// Write the data to file
-	if err := os.WriteFile(filename, data, 0644); err != nil {
+	if err := internal.WriteFileAtomic(filename, data, cm.backups); err != nil {
+		cm.logger.Error("failed to write configuration", "file", filename, "error", err)
 		return fmt.Errorf("failed to write data to file %s: %w", filename, err)
 	}
 
+	cm.logger.Info("saved configuration", "file", filename, "bytes", len(data), "edit", dc.Original != nil)
 	return nil
 }
 
-// UpdateKey updates a specific key in the configuration.
-func (cm *ConfigManager) UpdateKey(key string, value interface{}) error {
+// SetEditMode controls whether SaveToFile edits an existing file in place. In
+// edit mode only the values that changed are rewritten, keeping the comments,
+// key order and formatting of the file. A file that cannot be edited safely is
+// left untouched and SaveToFile returns an error wrapping formats.ErrNotPatchable,
+// unless SetEditFallback allows it to be rewritten.
+func (cm *ConfigManager) SetEditMode(enabled bool) {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
+	cm.editMode = enabled
+}
 
-	if _, exists := cm.data[key]; !exists {
-		return fmt.Errorf("key %s does not exist", key)
-	}
-	cm.data[key] = value
-	return nil
+// SetEditFallback controls whether SaveToFile, in edit mode, rewrites a file
+// from scratch when it cannot be edited in place, dropping its comments and
+// formatting. Each such rewrite is logged as a warning.
+func (cm *ConfigManager) SetEditFallback(enabled bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.editFallback = enabled
 }
 
-// UpdateKeys updates multiple keys in the configuration.
-func (cm *ConfigManager) UpdateKeys(updates map[string]interface{}) error {
+// SetBackups sets how many previous versions of a file SaveToFile keeps, as
+// filename.bak, filename.bak.1 and so on, newest first. Zero, the default,
+// keeps none.
+func (cm *ConfigManager) SetBackups(n int) {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
+	cm.backups = max(n, 0)
+}
 
-	for k, v := range updates {
-		if _, exists := cm.data[k]; !exists {
-			return fmt.Errorf("key %s does not exist", k)
-		}
-		cm.data[k] = v
+// SaveToWriter writes configuration data to w, using a DynamicConfig for format by default if no config saver is
+// provided. The format may be a format name such as "yaml", a file extension or a MIME type.
+func (cm *ConfigManager) SaveToWriter(w io.Writer, format string, config ...ConfigSaver) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	data, err := cm.save(&DynamicConfig{Format: format}, config)
+	if err != nil {
+		cm.logger.Error("failed to save configuration", "format", format, "error", err)
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		cm.logger.Error("failed to write configuration", "format", format, "error", err)
+		return fmt.Errorf("failed to write configuration: %w", err)
 	}
+	cm.logger.Debug("saved configuration", "format", format, "bytes", len(data))
 	return nil
 }
 
-// LoadEnvVariables loads configuration data from environment variables.
-func (cm *ConfigManager) LoadEnvVariables(config *DynamicConfig) error {
-	for key := range config.Data {
-		envKey := strings.ToUpper(strings.Replace(key, ".", "_", -1))
-		if value, exists := os.LookupEnv(envKey); exists {
-			// Update both the ConfigManager's data and the DynamicConfig's Data
-			cm.data[key] = value
-			config.Data[key] = value
+// save serializes the merged configuration with the saver passed to a variadic Save method or, if none was passed,
+// with dc. A saver that is also a ConfigLoader is first loaded with the current data, serialized by dc. The caller
+// must hold cm.mu.
+func (cm *ConfigManager) save(dc *DynamicConfig, config []ConfigSaver) ([]byte, error) {
+	cm.prepare(dc)
+	dc.Data = cm.current().data
+	dc.lists = cm.current().lists
+	dc.labels = cm.labels()
+	if len(config) == 0 {
+		return dc.Save()
+	}
+
+	saver := config[0]
+	// Update the config's data with the current ConfigManager data
+	if loader, ok := saver.(ConfigLoader); ok {
+		unflattenedBytes, err := dc.Save()
+		if err != nil {
+			return nil, err
+		}
+		if err := loader.Load(unflattenedBytes); err != nil {
+			return nil, fmt.Errorf("failed to update the config's data: %w", err)
 		}
 	}
-	return nil
+	return saver.Save()
 }
 
-// serializeData serializes unflattened data based on filename extension.
-func serializeData(filename string, data map[string]interface{}) ([]byte, error) {
-	switch ext := filepath.Ext(filename); ext {
-	case ".json":
-		return json.MarshalIndent(data, "", "  ")
-	case ".yaml", ".yml":
-		return yaml.Marshal(data)
-	case ".toml":
-		var buf bytes.Buffer
-		if err := toml.NewEncoder(&buf).Encode(data); err != nil {
-			return nil, err
+// UpdateKey updates a specific key in the configuration. The new value is stored in the runtime overrides layer.
+func (cm *ConfigManager) UpdateKey(key string, value interface{}) error {
+	return cm.Transaction(func(tx *Tx) error {
+		return tx.Update(key, value)
+	})
+}
+
+// UpdateKeys updates multiple keys in the configuration. The new values are stored in the runtime overrides layer.
+// The update is all or nothing: if any key does not exist, none are changed and the error lists every missing key.
+func (cm *ConfigManager) UpdateKeys(updates map[string]interface{}) error {
+	return cm.Transaction(func(tx *Tx) error {
+		var missing []string
+		for k := range updates {
+			if _, err := tx.Get(k); err != nil {
+				missing = append(missing, cm.normalize(k))
+			}
 		}
-		return buf.Bytes(), nil
-	case ".ini":
-		cfg := ini.Empty()
-		for k, v := range data {
-			sectionKey := strings.Split(k, ".")
-			section, key := ini.DefaultSection, sectionKey[0]
-			if len(sectionKey) > 1 {
-				section, key = sectionKey[0], sectionKey[1]
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return &MissingKeysError{Keys: missing}
+		}
+		for k, v := range updates {
+			if err := tx.Update(k, v); err != nil {
+				return err
 			}
-			cfg.Section(section).Key(key).SetValue(fmt.Sprint(v))
 		}
-		var buf bytes.Buffer
-		if _, err := cfg.WriteTo(&buf); err != nil {
-			return nil, err
+		return nil
+	})
+}
+
+// Set sets key to value in the runtime overrides layer, creating the key if it
+// does not exist. A map value replaces the whole section rooted at key, so keys
+// below key that value does not contain are removed, as is any value stored at
+// a parent of key, such as a.b when setting a.b.c.
+func (cm *ConfigManager) Set(key string, value interface{}) error {
+	return cm.Transaction(func(tx *Tx) error {
+		return tx.Set(key, value)
+	})
+}
+
+// Delete removes key from the configuration, whichever layers supply it. The
+// deletion is recorded in the runtime overrides layer, so the key stays removed
+// when lower layers are reloaded, until it is set again.
+func (cm *ConfigManager) Delete(key string) error {
+	return cm.Transaction(func(tx *Tx) error {
+		return tx.Delete(key)
+	})
+}
+
+// DeletePrefix removes prefix and every key below it, as Delete does. Deleting
+// a prefix that matches no key is not an error.
+func (cm *ConfigManager) DeletePrefix(prefix string) error {
+	return cm.Transaction(func(tx *Tx) error {
+		return tx.DeletePrefix(prefix)
+	})
+}
+
+// Has reports whether key holds a value or is the root of a section.
+func (cm *ConfigManager) Has(key string) bool {
+	return hasKey(cm.current().data, cm.normalize(key), cm.delim)
+}
+
+// Keys returns, sorted, every key that equals prefix or lies below it. An empty
+// prefix returns every key.
+func (cm *ConfigManager) Keys(prefix string) []string {
+	return keysUnder(cm.current().data, cm.normalize(prefix), cm.delim)
+}
+
+// fileFormat returns the format detected when filename was loaded with a
+// DynamicConfig, or nil if it was not. The caller must hold cm.mu.
+func (cm *ConfigManager) fileFormat(filename string) formats.Format {
+	if l, ok := cm.layers[filename]; ok {
+		if dc, ok := l.loader.(*DynamicConfig); ok {
+			return dc.format
 		}
-		return buf.Bytes(), nil
-	default:
-		return nil, fmt.Errorf("unsupported file format")
 	}
+	return nil
 }
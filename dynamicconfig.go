@@ -2,97 +2,200 @@ package configmanager
 
 import (
 	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"path/filepath"
 
+	"github.com/1broseidon/configmanager/formats"
 	"github.com/1broseidon/configmanager/internal"
-	"github.com/BurntSushi/toml"
-	"gopkg.in/ini.v1"
-	"gopkg.in/yaml.v2"
 )
 
-// DynamicConfig dynamically loads and saves configuration based on file extension.
+// DynamicConfig dynamically loads and saves configuration based on file extension,
+// using the format registered for that extension. When the extension is missing
+// or unknown, or the content does not parse in the format the extension names,
+// the format is detected from the content instead.
 type DynamicConfig struct {
 	Data     map[string]interface{}
 	Filename string
+	// Format, if set, names the format to use regardless of Filename. It may be
+	// a format name such as "yaml", a file extension or a MIME type.
+	Format string
+	// DefaultFormat, if set, names the format used when neither Format, the
+	// Filename extension nor the content identify one.
+	DefaultFormat string
+	// Delimiter separates the segments of the keys in Data, "." by default.
+	Delimiter string
+	// IndexArrays flattens each element of an array under its index, so a
+	// list of servers yields keys such as servers.0.host.
+	IndexArrays bool
+	// Original, if set, is the document Save edits in place: only changed
+	// values are rewritten, keeping its comments, key order and formatting.
+	Original []byte
+	// Rewrite lets Save re-serialize the document from scratch, dropping its
+	// comments, when Original cannot be edited in place. Otherwise Save fails
+	// with an error wrapping formats.ErrNotPatchable.
+	Rewrite bool
+
+	format formats.Format
+	lines  map[string]int
+	// lists holds the keys of the arrays in Data stored element by element.
+	// When it is nil, as for a DynamicConfig that was never loaded, Save
+	// restores every map whose keys are all indices as an array.
+	lists map[string]bool
+	// labels holds the number of labels of the blocks at each key of the
+	// document, joined with ".", for formats such as HCL; see formats.LabelEncoder.
+	labels map[string]int
+	// rewritten records why Original was re-serialized rather than edited.
+	rewritten error
 }
 
 // Load dynamically loads configuration based on file extension.
 func (dc *DynamicConfig) Load(data []byte) error {
-	var temp map[string]interface{}
-	var err error
-
-	switch ext := filepath.Ext(dc.Filename); ext {
-	case ".json":
-		err = json.Unmarshal(data, &temp)
-	case ".yaml", ".yml":
-		err = yaml.Unmarshal(data, &temp)
-	case ".toml":
-		_, err = toml.Decode(string(data), &temp)
-	case ".ini":
-		cfg, iniErr := ini.Load(data)
-		if iniErr == nil {
-			temp = map[string]interface{}{}
-			for _, section := range cfg.Sections() {
-				for _, key := range section.Keys() {
-					if section.Name() == ini.DefaultSection {
-						temp[key.Name()] = key.Value()
-					} else {
-						temp[fmt.Sprintf("%s.%s", section.Name(), key.Name())] = key.Value()
-					}
-				}
-			}
-			err = nil
-		} else {
-			err = fmt.Errorf("unsupported data format or failed to parse data: %w", iniErr)
-		}
-	default:
-		err = fmt.Errorf("unsupported file format")
-	}
-
+	format, temp, err := dc.decode(data)
 	if err != nil {
 		return fmt.Errorf("failed to load data: %w", err)
 	}
 
 	// Flatten the loaded configuration data
-	dc.Data = internal.Flatten(temp)
+	f := dc.flattener(format)
+	f.Lists = make(map[string]bool)
+	dc.Data = f.Flatten(temp)
+	dc.lists = f.Lists
+	dc.labels = formats.Labels(format, data)
+	dc.format = format
+	dc.lines = internal.RekeyLines(formats.KeyLines(format, data), dc.Data, dc.delimiter())
 
 	return nil
 }
 
-// Save dynamically saves configuration based on file extension.
+// Save dynamically saves configuration based on file extension, or in the
+// format detected by the last Load if the extension is not recognised. If
+// Original is set, it is patched rather than re-serialized from scratch; see Rewrite.
 func (dc *DynamicConfig) Save() ([]byte, error) {
-	// Unflatten the data
-	data := internal.Unflatten(dc.Data)
-
-	switch ext := filepath.Ext(dc.Filename); ext {
-	case ".json":
-		return json.MarshalIndent(data, "", "  ")
-	case ".yaml", ".yml":
-		return yaml.Marshal(data)
-	case ".toml":
-		var buf bytes.Buffer
-		if err := toml.NewEncoder(&buf).Encode(data); err != nil {
+	var format formats.Format
+	var err error
+	if dc.Format != "" {
+		format, err = formats.Resolve(dc.Format)
+	} else {
+		format, err = formats.ForFile(dc.Filename)
+	}
+	if err != nil {
+		switch {
+		case dc.Format != "":
 			return nil, err
-		}
-		return buf.Bytes(), nil
-	case ".ini":
-		cfg := ini.Empty()
-		for k, v := range data {
-			cfg.Section("").Key(k).SetValue(fmt.Sprint(v))
-		}
-		var buf bytes.Buffer
-		if _, err := cfg.WriteTo(&buf); err != nil {
+		case dc.format != nil:
+			format = dc.format
+		case dc.DefaultFormat != "":
+			if format, err = formats.Resolve(dc.DefaultFormat); err != nil {
+				return nil, err
+			}
+		default:
 			return nil, err
 		}
-		return buf.Bytes(), nil
-	default:
-		return nil, fmt.Errorf("unsupported file format")
 	}
+	f := dc.flattener(format)
+	f.Lists = dc.lists
+	data, err := f.Unflatten(dc.Data)
+	if err != nil {
+		return nil, err
+	}
+	dc.rewritten = nil
+	if len(bytes.TrimSpace(dc.Original)) == 0 {
+		return formats.EncodeLabels(format, data, dc.labels)
+	}
+	patched, err := formats.Patch(format, dc.Original, data)
+	if errors.Is(err, formats.ErrNotPatchable) && dc.Rewrite {
+		dc.rewritten = err
+		return formats.EncodeLabels(format, data, dc.labels)
+	}
+	return patched, err
 }
 
 // GetData retrieves the configuration data from DynamicConfig.
 func (dc *DynamicConfig) GetData() map[string]interface{} {
 	return dc.Data
 }
+
+// KeyLines reports the line on which each key was defined in the last loaded document.
+func (dc *DynamicConfig) KeyLines() map[string]int {
+	return dc.lines
+}
+
+// Labels reports the number of labels of the blocks at each key of the last
+// loaded document, for formats such as HCL that label blocks.
+func (dc *DynamicConfig) Labels() map[string]int {
+	return dc.labels
+}
+
+// delimiter returns the delimiter of the keys in Data.
+func (dc *DynamicConfig) delimiter() string {
+	if dc.Delimiter == "" {
+		return internal.DefaultDelimiter
+	}
+	return dc.Delimiter
+}
+
+// flattener returns the Flattener converting between documents of format and Data.
+func (dc *DynamicConfig) flattener(format formats.Format) internal.Flattener {
+	return formats.Flattener(format, dc.delimiter(), dc.IndexArrays)
+}
+
+// decode decodes data as detect does, falling back to DefaultFormat when the
+// filename has no registered extension and the content is not recognised.
+func (dc *DynamicConfig) decode(data []byte) (formats.Format, map[string]interface{}, error) {
+	format, temp, err := dc.detect(data)
+	if err == nil || dc.Format != "" || dc.DefaultFormat == "" {
+		return format, temp, err
+	}
+	if _, extErr := formats.ForFile(dc.Filename); extErr == nil {
+		return nil, nil, err
+	}
+	fallback, resolveErr := formats.Resolve(dc.DefaultFormat)
+	if resolveErr != nil {
+		return nil, nil, resolveErr
+	}
+	temp, decodeErr := fallback.Decode(data)
+	if decodeErr != nil {
+		return nil, nil, decodeErr
+	}
+	return fallback, temp, nil
+}
+
+// detect decodes data in the explicitly requested Format or, failing that,
+// using the format registered for the filename extension. Content detection is
+// used only when there is no such format or the content fails to decode in it,
+// such as JSON saved with a .toml extension.
+func (dc *DynamicConfig) detect(data []byte) (formats.Format, map[string]interface{}, error) {
+	if dc.Format != "" {
+		format, err := formats.Resolve(dc.Format)
+		if err != nil {
+			return nil, nil, err
+		}
+		temp, err := format.Decode(data)
+		return format, temp, err
+	}
+
+	format, err := formats.ForFile(dc.Filename)
+	if err == nil {
+		var temp map[string]interface{}
+		if temp, err = format.Decode(data); err == nil {
+			return format, temp, nil
+		}
+	}
+
+	detected, confidence := formats.DetectFormat(data)
+	if confidence < formats.MinDetectConfidence {
+		detected = nil
+	}
+
+	if detected == nil || detected == format {
+		return nil, nil, err
+	}
+	temp, detectErr := detected.Decode(data)
+	if detectErr != nil {
+		if err == nil {
+			err = detectErr
+		}
+		return nil, nil, err
+	}
+	return detected, temp, nil
+}
@@ -0,0 +1,357 @@
+package configmanager
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/1broseidon/configmanager/internal"
+)
+
+// DefaultEnvPrefix is the prefix of the environment variables read by LoadEnv
+// when neither WithEnvPrefix nor EnvPrefix sets one.
+const DefaultEnvPrefix = "CONFIG"
+
+// EnvOption configures LoadEnv.
+type EnvOption func(*envSource)
+
+// envSource describes which environment variables LoadEnv reads and how.
+type envSource struct {
+	prefix    string
+	name      func(key string) string
+	key       func(name string) string
+	allowNew  bool
+	separator string
+	raw       bool
+	// keys, if set, restricts the source to these keys.
+	keys []string
+}
+
+// EnvPrefix sets the prefix of the variables LoadEnv reads, so that with the
+// prefix "MYAPP" the key database.host is overridden by MYAPP_DATABASE_HOST.
+// An empty prefix reads unprefixed variables such as DATABASE_HOST.
+func EnvPrefix(prefix string) EnvOption {
+	return func(s *envSource) {
+		s.prefix = strings.TrimSuffix(strings.ToUpper(prefix), "_")
+	}
+}
+
+// EnvNameFunc sets the function mapping a key to the name of the variable that
+// overrides it, before the prefix is added. By default the segments of the key
+// are joined with underscores and upper-cased, so database.max_conns is read
+// from DATABASE_MAX_CONNS.
+func EnvNameFunc(fn func(key string) string) EnvOption {
+	return func(s *envSource) {
+		s.name = fn
+	}
+}
+
+// EnvKeyFunc sets the function mapping the name of a variable, without its
+// prefix, to the key it sets when EnvAllowNew is given. By default the name is
+// lower-cased and every underscore separates two segments, so DATABASE_HOST
+// sets database.host.
+func EnvKeyFunc(fn func(name string) string) EnvOption {
+	return func(s *envSource) {
+		s.key = fn
+	}
+}
+
+// EnvAllowNew makes LoadEnv add a key for every prefixed variable, not only
+// for the variables overriding keys that already exist. It requires a prefix.
+// A variable whose key would collide with another, as server does with
+// server.port, is ignored and logged.
+func EnvAllowNew() EnvOption {
+	return func(s *envSource) {
+		s.allowNew = true
+	}
+}
+
+// EnvListSeparator sets the separator on which the values of variables
+// overriding list keys are split, "," by default.
+func EnvListSeparator(sep string) EnvOption {
+	return func(s *envSource) {
+		if sep != "" {
+			s.separator = sep
+		}
+	}
+}
+
+// EnvRawStrings stores every value as the string it was given as, rather than
+// converting it to the type of the value it overrides.
+func EnvRawStrings() EnvOption {
+	return func(s *envSource) {
+		s.raw = true
+	}
+}
+
+// LoadEnv registers environment variables as the env layer, replacing any
+// previous env layer. Every key supplied by another layer is overridden by the
+// variable named after it, and the value is converted to the type of the value
+// it overrides: "8080" overrides a port as an int, "true" a flag as a bool, and
+// "a,b,c" a list as a list. Variables are only read for existing keys unless
+// EnvAllowNew is given. If any variable cannot be converted, nothing changes.
+//
+// Variables are prefixed with the WithEnvPrefix prefix or, failing that,
+// DefaultEnvPrefix, so database.host is read from CONFIG_DATABASE_HOST.
+func (cm *ConfigManager) LoadEnv(opts ...EnvOption) error {
+	src := &envSource{prefix: cm.envPrefix}
+	if src.prefix == "" {
+		src.prefix = DefaultEnvPrefix
+	}
+	for _, opt := range opts {
+		opt(src)
+	}
+	_, err := cm.loadEnv(src)
+	return err
+}
+
+// LoadEnvVariables loads configuration data from environment variables into the env layer.
+// Only the keys of config are read, from unprefixed variables unless WithEnvPrefix is given,
+// and their values are stored as strings, which are also written back to config.Data.
+//
+// Deprecated: Use LoadEnv, which reads every key, converts values to the types they
+// override and can add new keys.
+func (cm *ConfigManager) LoadEnvVariables(config *DynamicConfig) error {
+	src := &envSource{prefix: cm.envPrefix, raw: true, keys: make([]string, 0, len(config.Data))}
+	for name := range config.Data {
+		src.keys = append(src.keys, name)
+	}
+	env, err := cm.loadEnv(src)
+	if err != nil {
+		return err
+	}
+
+	// Keep the DynamicConfig's Data in step with the ConfigManager's env layer
+	for name := range config.Data {
+		if value, ok := env[cm.normalize(name)]; ok {
+			config.Data[name] = value
+		}
+	}
+	return nil
+}
+
+// loadEnv reads the variables described by src and registers them as the env layer, returning its data.
+func (cm *ConfigManager) loadEnv(src *envSource) (map[string]interface{}, error) {
+	if src.allowNew && src.prefix == "" {
+		return nil, fmt.Errorf("loading new keys from the environment requires a prefix")
+	}
+	if src.name == nil {
+		src.name = cm.envName
+	}
+	if src.key == nil {
+		src.key = cm.envKey
+	}
+	if src.separator == "" {
+		src.separator = ","
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	// Existing keys are those of every other layer, so that a key added by a
+	// previous LoadEnv disappears with its variable.
+	existing, _ := cm.merge(LayerEnv)
+	keys := src.keys
+	if keys == nil {
+		keys = make([]string, 0, len(existing))
+		for k := range existing {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	env := make(map[string]interface{})
+	envVars := make(map[string]string)
+	for _, key := range keys {
+		key = cm.normalize(key)
+		name := src.variable(src.name(key))
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		value, err := src.convert(raw, existing[key])
+		if err != nil {
+			if isSecretKey(key) || isSecretKey(name) {
+				// Conversion errors quote the value, which must not leak.
+				err = fmt.Errorf("value %s is not a valid %T", redacted, existing[key])
+			}
+			cm.logger.Error("failed to read environment variable", "env", name, "error", err)
+			return nil, fmt.Errorf("invalid value for environment variable %s: %w", name, err)
+		}
+		env[key] = value
+		envVars[key] = name
+		cm.logger.Debug("applied environment override", "key", key, "env", name, valueAttr(key, value))
+	}
+
+	if src.allowNew {
+		used := make(map[string]bool, len(envVars))
+		for _, name := range envVars {
+			used[name] = true
+		}
+		environ := os.Environ()
+		sort.Strings(environ)
+		for _, kv := range environ {
+			name, raw, _ := strings.Cut(kv, "=")
+			rest, ok := strings.CutPrefix(name, src.prefix+"_")
+			if !ok || rest == "" || used[name] {
+				continue
+			}
+			key := cm.normalize(src.key(rest))
+			if _, ok := env[key]; ok {
+				continue
+			}
+			// A key holding a value cannot have keys below it, so a variable
+			// such as APP_SERVER is ignored when server.port exists.
+			conflict, ok := collision(existing, key, cm.delim)
+			if !ok {
+				conflict, ok = collision(env, key, cm.delim)
+			}
+			if ok {
+				cm.logger.Warn("ignored environment variable", "env", name, "key", key, "conflicts_with", conflict)
+				continue
+			}
+			env[key] = raw
+			envVars[key] = name
+			cm.logger.Debug("added key from environment", "key", key, "env", name, valueAttr(key, raw))
+		}
+	}
+
+	if err := cm.setLayer(&layer{name: LayerEnv, priority: PriorityEnv, data: env, envVars: envVars}); err != nil {
+		return nil, err
+	}
+	cm.logger.Info("loaded environment overrides", "keys", len(env))
+	return env, nil
+}
+
+// collision returns a key of data that cannot coexist with key: one below it,
+// or one above it, since a key holding a value cannot have keys below it.
+func collision(data map[string]interface{}, key, delim string) (string, bool) {
+	for _, k := range keysUnder(data, key, delim) {
+		if k != key {
+			return k, true
+		}
+	}
+	segments := internal.SplitKey(key, delim)
+	for i := 1; i < len(segments); i++ {
+		parent := internal.JoinSegments(segments[:i], delim)
+		if _, ok := data[parent]; ok {
+			return parent, true
+		}
+	}
+	return "", false
+}
+
+// variable returns the full name of the variable with the given unprefixed name.
+func (s *envSource) variable(name string) string {
+	if s.prefix == "" {
+		return name
+	}
+	return s.prefix + "_" + name
+}
+
+// convert converts the raw value of a variable to the type of like, the value
+// it overrides. Lists are split on the separator and their elements converted
+// to the type of the list's elements.
+func (s *envSource) convert(raw string, like interface{}) (interface{}, error) {
+	if s.raw || like == nil {
+		return raw, nil
+	}
+	if _, ok := like.(time.Duration); ok {
+		return internal.ToDuration(raw)
+	}
+
+	rv := reflect.ValueOf(like)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return internal.ToBool(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// The getters' converters are used, so a variable accepts the same
+		// forms, such as 0x1F, as GetInt does for the key.
+		i, err := internal.ToInt64(raw)
+		if err != nil {
+			return nil, err
+		}
+		if rv.OverflowInt(i) {
+			return nil, fmt.Errorf("%s is out of range for %s", raw, rv.Type())
+		}
+		return reflect.ValueOf(i).Convert(rv.Type()).Interface(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := internal.ToInt64(raw)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || rv.OverflowUint(uint64(i)) {
+			return nil, fmt.Errorf("%s is out of range for %s", raw, rv.Type())
+		}
+		return reflect.ValueOf(i).Convert(rv.Type()).Interface(), nil
+	case reflect.Float32, reflect.Float64:
+		f, err := internal.ToFloat64(raw)
+		if err != nil {
+			return nil, err
+		}
+		if rv.OverflowFloat(f) {
+			return nil, fmt.Errorf("%s is out of range for %s", raw, rv.Type())
+		}
+		return reflect.ValueOf(f).Convert(rv.Type()).Interface(), nil
+	case reflect.Slice, reflect.Array:
+		return s.convertList(raw, rv)
+	}
+	return raw, nil
+}
+
+// convertList splits raw into a list of the same type as list.
+func (s *envSource) convertList(raw string, list reflect.Value) (interface{}, error) {
+	var parts []string
+	if strings.TrimSpace(raw) != "" {
+		parts = strings.Split(raw, s.separator)
+	}
+
+	elemType := list.Type().Elem()
+	// An element of an []interface{} is converted like the list's first element.
+	var elemLike interface{}
+	if elemType.Kind() != reflect.Interface {
+		elemLike = reflect.Zero(elemType).Interface()
+	} else if list.Len() > 0 {
+		elemLike = list.Index(0).Interface()
+	}
+
+	sliceType := list.Type()
+	if list.Kind() == reflect.Array {
+		sliceType = reflect.SliceOf(elemType)
+	}
+	result := reflect.MakeSlice(sliceType, len(parts), len(parts))
+	for i, part := range parts {
+		value, err := s.convert(strings.TrimSpace(part), elemLike)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		if !reflect.TypeOf(value).AssignableTo(elemType) {
+			return nil, fmt.Errorf("element %d: cannot convert %q to %s", i, part, elemType)
+		}
+		result.Index(i).Set(reflect.ValueOf(value))
+	}
+	return result.Interface(), nil
+}
+
+// envName returns the unprefixed name of the variable that overrides key: its
+// segments joined with underscores and upper-cased. Any other character that
+// cannot appear in a variable name becomes an underscore.
+func (cm *ConfigManager) envName(key string) string {
+	name := strings.Join(internal.SplitKey(key, cm.delim), "_")
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+	return strings.ToUpper(name)
+}
+
+// envKey returns the key set by the variable with the given unprefixed name:
+// its lower-cased words, separated by underscores, as segments.
+func (cm *ConfigManager) envKey(name string) string {
+	return internal.JoinSegments(strings.Split(strings.ToLower(name), "_"), cm.delim)
+}
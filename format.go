@@ -0,0 +1,27 @@
+package configmanager
+
+import "github.com/1broseidon/configmanager/formats"
+
+// Format describes a configuration file format. See formats.Format.
+type Format = formats.Format
+
+// ErrUnsupportedFormat is returned when no registered format matches a file.
+var ErrUnsupportedFormat = formats.ErrUnsupportedFormat
+
+// RegisterFormat makes f available to DynamicConfig, ConfigManager and the
+// formats package for every extension and MIME type it declares. JSON, YAML,
+// TOML and INI are registered by default.
+func RegisterFormat(f Format) error {
+	return formats.Register(f)
+}
+
+// LookupFormat returns the format registered under name or file extension.
+func LookupFormat(name string) (Format, bool) {
+	return formats.Lookup(name)
+}
+
+// DetectFormat sniffs data and returns the registered format most likely to
+// match it, with a confidence between 0 and 1. See formats.DetectFormat.
+func DetectFormat(data []byte) (Format, float64) {
+	return formats.DetectFormat(data)
+}
@@ -0,0 +1,104 @@
+package formats
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// MinDetectConfidence is the confidence DetectFormat must reach before callers
+// such as DynamicConfig rely on its guess.
+const MinDetectConfidence = 0.5
+
+// Detector is implemented by formats that can recognise their own content.
+type Detector interface {
+	// Detect returns a confidence between 0 and 1 that data is in this format.
+	Detect(data []byte) float64
+}
+
+// DetectFormat sniffs data and returns the registered format most likely to
+// match it, together with a confidence between 0 and 1. Formats that do not
+// implement Detector are never returned. If nothing matches, DetectFormat
+// returns a nil Format and a confidence of 0.
+func DetectFormat(data []byte) (Format, float64) {
+	var best Format
+	var bestScore float64
+	for _, f := range Formats() {
+		detector, ok := f.(Detector)
+		if !ok {
+			continue
+		}
+		if score := detector.Detect(data); score > bestScore {
+			best, bestScore = f, score
+		}
+	}
+	return best, bestScore
+}
+
+var (
+	sectionLine   = regexp.MustCompile(`^\[\[?[^\[\]=]+\]\]?$`)
+	assignLine    = regexp.MustCompile(`^[\w.\-"' ]+\s*=`)
+	colonLine     = regexp.MustCompile(`^[\w.\-"' ]+\s*:`)
+	yamlKeyLine   = regexp.MustCompile(`^\s*(- )?[\w.\-"']+:(\s|$)`)
+	yamlBlockLine = regexp.MustCompile(`^\s*- `)
+)
+
+// lineStats summarises the shape of a line-oriented document for the detectors.
+type lineStats struct {
+	total       int
+	sections    int
+	assigns     int
+	colons      int
+	yamlKeys    int
+	yamlItems   int
+	indented    int
+	hashComment int
+	semiComment int
+}
+
+func scanStats(data []byte) lineStats {
+	var st lineStats
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || trimmed == "---":
+			continue
+		case strings.HasPrefix(trimmed, "#"):
+			st.hashComment++
+			continue
+		case strings.HasPrefix(trimmed, ";"):
+			st.semiComment++
+			continue
+		}
+
+		st.total++
+		if line != strings.TrimLeft(line, " \t") {
+			st.indented++
+		}
+		switch {
+		case sectionLine.MatchString(trimmed):
+			st.sections++
+		case assignLine.MatchString(trimmed):
+			st.assigns++
+		case yamlKeyLine.MatchString(line):
+			st.yamlKeys++
+		case yamlBlockLine.MatchString(line):
+			st.yamlItems++
+		case colonLine.MatchString(trimmed):
+			st.colons++
+		}
+	}
+	return st
+}
+
+// ratio returns n as a fraction of the non-comment lines.
+func (st lineStats) ratio(n int) float64 {
+	if st.total == 0 {
+		return 0
+	}
+	return float64(n) / float64(st.total)
+}
+
+func trimmedStartsWith(data []byte, prefix string) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte(prefix))
+}
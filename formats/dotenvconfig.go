@@ -0,0 +1,151 @@
+package formats
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/1broseidon/configmanager/internal"
+)
+
+// Dotenv is the built-in format for .env files. Each variable sets the key made
+// of its lower-cased words, so DATABASE_HOST=localhost sets database.host, and
+// keys are written back as upper-case names joined with underscores. A key may
+// hold a value and have keys below it, as DATABASE and DATABASE_HOST do. Every
+// value is read as a string; lists are written comma-separated.
+var Dotenv Format = dotenvFormat{}
+
+type dotenvFormat struct{}
+
+// dotenvFlattener flattens the nested maps of the dotenv format.
+var dotenvFlattener = Flattener(Dotenv, internal.DefaultDelimiter, false)
+
+func (dotenvFormat) Name() string         { return "dotenv" }
+func (dotenvFormat) Extensions() []string { return []string{".env"} }
+func (dotenvFormat) MIMETypes() []string  { return []string{"text/x-dotenv"} }
+func (dotenvFormat) SectionValues() bool  { return true }
+
+func (dotenvFormat) Decode(data []byte) (map[string]interface{}, error) {
+	vars, err := internal.ParseDotenv(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dotenv data: %w", err)
+	}
+	flat := make(map[string]interface{}, len(vars))
+	for _, v := range vars {
+		if key := internal.DotenvKey(v.Name); key != "" {
+			flat[key] = v.Value
+		}
+	}
+	return dotenvFlattener.Unflatten(flat)
+}
+
+func (dotenvFormat) Encode(data map[string]interface{}) ([]byte, error) {
+	values := dotenvFlattener.Flatten(data)
+	keys := make(map[string]string, len(values))
+	var buf bytes.Buffer
+	for _, k := range sortedKeys(values) {
+		name := internal.DotenvName(k)
+		if other, ok := keys[name]; ok {
+			return nil, fmt.Errorf("failed to write dotenv data: keys %s and %s are both written as %s", other, k, name)
+		}
+		keys[name] = k
+		fmt.Fprintf(&buf, "%s=%s\n", name, dotenvValue(values[k]))
+	}
+	return buf.Bytes(), nil
+}
+
+// Patch replaces the changed values of original line by line, keeping comments,
+// export prefixes and the references of values that still expand to the same text.
+func (f dotenvFormat) Patch(original []byte, data map[string]interface{}) ([]byte, error) {
+	current, err := f.Decode(original)
+	if err != nil {
+		return nil, err
+	}
+	return internal.PatchDotenv(internal.LinePatch{
+		Original: original,
+		Current:  dotenvFlattener.Flatten(current),
+		Data:     dotenvFlattener.Flatten(data),
+		Render:   func(v interface{}) (string, error) { return dotenvValue(v), nil },
+	})
+}
+
+func (dotenvFormat) KeyLines(data []byte) map[string]int {
+	return internal.DotenvKeyLines(data)
+}
+
+var dotenvName = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// Detect recognises documents of NAME=value assignments. Upper-case names,
+// export prefixes and ${VAR} references set dotenv apart from INI and TOML
+// documents without sections; a few lower-case names among upper-case ones
+// still score as dotenv.
+func (dotenvFormat) Detect(data []byte) float64 {
+	vars, err := internal.ParseDotenv(data)
+	if err != nil || len(vars) == 0 {
+		return 0
+	}
+	upper := 0
+	for _, v := range vars {
+		if dotenvName.MatchString(v.Name) {
+			upper++
+		}
+	}
+	confidence := 0.4 + 0.4*float64(upper)/float64(len(vars))
+	if bytes.Contains(data, []byte("export ")) {
+		confidence += 0.1
+	}
+	if bytes.Contains(data, []byte("${")) {
+		confidence += 0.1
+	}
+	return confidence
+}
+
+// dotenvValue renders a value as a dotenv value, double-quoting it when it
+// holds characters that would otherwise be read differently.
+func dotenvValue(v interface{}) string {
+	s := iniValue(v)
+	if !strings.ContainsAny(s, " \t\r\n#'\"\\$`") {
+		return s
+	}
+	return `"` + dotenvEscaper.Replace(s) + `"`
+}
+
+var dotenvEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, `$`, `\$`)
+
+// DotenvConfig handles dotenv configuration.
+type DotenvConfig struct {
+	Data map[string]interface{}
+
+	lines map[string]int
+}
+
+// Load loads dotenv configuration data.
+func (dc *DotenvConfig) Load(data []byte) error {
+	temp, err := Dotenv.Decode(data)
+	if err != nil {
+		return err
+	}
+	dc.Data = dotenvFlattener.Flatten(temp)
+	dc.lines = KeyLines(Dotenv, data)
+	return nil
+}
+
+// Save saves dotenv configuration data.
+func (dc *DotenvConfig) Save() ([]byte, error) {
+	data, err := dotenvFlattener.Unflatten(dc.Data)
+	if err != nil {
+		return nil, err
+	}
+	return Dotenv.Encode(data)
+}
+
+// GetData retrieves the configuration data from DotenvConfig.
+func (dc *DotenvConfig) GetData() map[string]interface{} {
+	return dc.Data
+}
+
+// KeyLines reports the line on which each key was defined in the last loaded document.
+func (dc *DotenvConfig) KeyLines() map[string]int {
+	return dc.lines
+}
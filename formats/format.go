@@ -0,0 +1,268 @@
+package formats
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/1broseidon/configmanager/internal"
+)
+
+// ErrUnsupportedFormat is returned when no registered format matches a name, extension or MIME type.
+var ErrUnsupportedFormat = errors.New("unsupported file format")
+
+// ErrNotPatchable is returned by Patch when a document cannot be edited in place
+// without losing data, or when its format does not implement Patcher.
+var ErrNotPatchable = errors.New("document cannot be edited in place")
+
+// Format describes a configuration file format. Decode and Encode work with
+// nested maps; flattening to dotted keys is done by the callers.
+type Format interface {
+	// Name is the short, unique name of the format, such as "json".
+	Name() string
+	// Extensions lists the file extensions handled by the format, including the leading dot.
+	Extensions() []string
+	// MIMETypes lists the media types handled by the format.
+	MIMETypes() []string
+	// Decode parses a document into a nested map.
+	Decode(data []byte) (map[string]interface{}, error)
+	// Encode serializes a nested map into a document.
+	Encode(data map[string]interface{}) ([]byte, error)
+}
+
+// LineLocator is implemented by formats that can report the line on which each
+// flattened key of a document is defined.
+type LineLocator interface {
+	KeyLines(data []byte) map[string]int
+}
+
+// Patcher is implemented by formats that can rewrite an existing document to
+// hold new data while keeping its comments, key order and formatting.
+type Patcher interface {
+	Patch(original []byte, data map[string]interface{}) ([]byte, error)
+}
+
+// SectionValuer is implemented by formats in which a key may both hold a value
+// and have keys below it, as log4j.appender.A1 and log4j.appender.A1.layout do
+// in a properties file. Decode stores the value of such a key under the empty
+// key of its section, and Encode reads it from there.
+type SectionValuer interface {
+	SectionValues() bool
+}
+
+// LabelEncoder is implemented by formats whose blocks carry labels that Decode
+// turns into nested keys, as service "web" { ... } becomes service.web in HCL.
+// Labels reports how many labels the blocks at each flattened key of a document
+// have, and EncodeLabels writes those blocks back with as many labels.
+type LabelEncoder interface {
+	Labels(data []byte) map[string]int
+	EncodeLabels(data map[string]interface{}, labels map[string]int) ([]byte, error)
+}
+
+// registry holds every registered format, indexed by name, extension and MIME type.
+var registry = struct {
+	mu     sync.RWMutex
+	byName map[string]Format
+	byExt  map[string]Format
+	byMIME map[string]Format
+}{
+	byName: make(map[string]Format),
+	byExt:  make(map[string]Format),
+	byMIME: make(map[string]Format),
+}
+
+func init() {
+	for _, f := range []Format{JSON, YAML, TOML, INI, Dotenv, Properties, HCL} {
+		if err := Register(f); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Register adds f to the registry. A format registered under an existing name,
+// extension or MIME type replaces the previous registration for it, which lets
+// applications swap in their own implementation of a built-in format.
+func Register(f Format) error {
+	name := strings.ToLower(f.Name())
+	if name == "" {
+		return fmt.Errorf("format must have a name")
+	}
+	if len(f.Extensions()) == 0 {
+		return fmt.Errorf("format %s must have at least one extension", name)
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	registry.byName[name] = f
+	for _, ext := range f.Extensions() {
+		registry.byExt[normalizeExt(ext)] = f
+	}
+	for _, mime := range f.MIMETypes() {
+		registry.byMIME[strings.ToLower(mime)] = f
+	}
+	return nil
+}
+
+// Lookup returns the format registered under name, or under the extension name if no format has that name.
+func Lookup(name string) (Format, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	if f, ok := registry.byName[strings.ToLower(name)]; ok {
+		return f, true
+	}
+	f, ok := registry.byExt[normalizeExt(name)]
+	return f, ok
+}
+
+// ForExtension returns the format registered for ext, with or without the leading dot.
+func ForExtension(ext string) (Format, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	f, ok := registry.byExt[normalizeExt(ext)]
+	return f, ok
+}
+
+// ForMIMEType returns the format registered for the media type mime. Parameters such as "; charset=utf-8" are ignored.
+func ForMIMEType(mime string) (Format, bool) {
+	mime = strings.TrimSpace(strings.Split(mime, ";")[0])
+
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	f, ok := registry.byMIME[strings.ToLower(mime)]
+	return f, ok
+}
+
+// ForFile returns the format registered for the extension of filename. A
+// dotfile named after an extension and a suffix, such as .env.local, uses the
+// format of that extension when its own extension has none.
+func ForFile(filename string) (Format, error) {
+	ext := filepath.Ext(filename)
+	if f, ok := ForExtension(ext); ok {
+		return f, nil
+	}
+	if base := filepath.Base(filename); strings.HasPrefix(base, ".") {
+		if i := strings.Index(base[1:], "."); i > 0 {
+			if f, ok := ForExtension(base[:i+1]); ok {
+				return f, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, ext)
+}
+
+// Resolve returns the format registered under name, which may be a format
+// name, a file extension or a MIME type.
+func Resolve(name string) (Format, error) {
+	if f, ok := Lookup(name); ok {
+		return f, nil
+	}
+	if f, ok := ForMIMEType(name); ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, name)
+}
+
+// Formats returns every registered format, sorted by name.
+func Formats() []Format {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	list := make([]Format, 0, len(registry.byName))
+	for _, f := range registry.byName {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// KeyLines returns the line on which each flattened key of data is defined, if f can report it.
+func KeyLines(f Format, data []byte) map[string]int {
+	if locator, ok := f.(LineLocator); ok {
+		return locator.KeyLines(data)
+	}
+	return nil
+}
+
+// Labels returns the label counts of the blocks of data if f is a LabelEncoder,
+// or nil otherwise.
+func Labels(f Format, data []byte) map[string]int {
+	if encoder, ok := f.(LabelEncoder); ok {
+		return encoder.Labels(data)
+	}
+	return nil
+}
+
+// EncodeLabels encodes data in f, writing the blocks at the keys in labels with
+// that many labels when f is a LabelEncoder.
+func EncodeLabels(f Format, data map[string]interface{}, labels map[string]int) ([]byte, error) {
+	if encoder, ok := f.(LabelEncoder); ok && len(labels) > 0 {
+		return encoder.EncodeLabels(data, labels)
+	}
+	return f.Encode(data)
+}
+
+// Flattener returns the Flattener that converts the nested maps of f to flat
+// keys joined with delim and back, keeping the values of sections of a
+// SectionValuer.
+func Flattener(f Format, delim string, indexArrays bool) internal.Flattener {
+	valuer, ok := f.(SectionValuer)
+	return internal.Flattener{Delim: delim, IndexArrays: indexArrays, SectionValues: ok && valuer.SectionValues()}
+}
+
+// Patch rewrites original so that it holds data, keeping as much of its comments,
+// key order and formatting as f allows. Data is encoded from scratch when
+// original is empty. Patch never silently drops the formatting of a document:
+// when f does not implement Patcher, the patcher fails, or the patched document
+// would not read back the same as the encoded one, it returns an error wrapping
+// ErrNotPatchable, and the caller may choose to call Encode instead.
+func Patch(f Format, original []byte, data map[string]interface{}) ([]byte, error) {
+	encoded, err := f.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(original))) == 0 {
+		return encoded, nil
+	}
+	patcher, ok := f.(Patcher)
+	if !ok {
+		return nil, fmt.Errorf("%w: the %s format does not support editing", ErrNotPatchable, f.Name())
+	}
+	patched, err := patcher.Patch(original, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotPatchable, err)
+	}
+	if !sameContent(f, patched, encoded) {
+		return nil, fmt.Errorf("%w: the edited %s document would not read back unchanged", ErrNotPatchable, f.Name())
+	}
+	return patched, nil
+}
+
+// sameContent reports whether a and b decode to the same flattened data in f.
+func sameContent(f Format, a, b []byte) bool {
+	da, err := f.Decode(a)
+	if err != nil {
+		return false
+	}
+	db, err := f.Decode(b)
+	if err != nil {
+		return false
+	}
+	flat := Flattener(f, internal.DefaultDelimiter, false)
+	return reflect.DeepEqual(flat.Flatten(da), flat.Flatten(db))
+}
+
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
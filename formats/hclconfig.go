@@ -0,0 +1,629 @@
+package formats
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/1broseidon/configmanager/internal"
+)
+
+// HCL is the built-in format for HCL files, such as Terraform .tfvars files.
+// Attributes become keys and blocks nest their content under their type and
+// labels, so service "web" { port = 80 } sets service.web.port. Blocks of the
+// same type and labels that appear more than once become a list. Expressions
+// must be literals: variables and function calls cannot be evaluated.
+//
+// Maps are written back as nested blocks, or as object attributes when their
+// keys are not valid identifiers, and lists of maps as repeated blocks. Blocks
+// are written with labels where EncodeLabels is told to.
+var HCL Format = hclFormat{}
+
+type hclFormat struct{}
+
+func (hclFormat) Name() string         { return "hcl" }
+func (hclFormat) Extensions() []string { return []string{".hcl", ".tfvars"} }
+func (hclFormat) MIMETypes() []string  { return []string{"application/hcl", "text/x-hcl"} }
+
+func (hclFormat) Decode(data []byte) (map[string]interface{}, error) {
+	body, err := parseHCL(data)
+	if err != nil {
+		return nil, err
+	}
+	return decodeHCLBody(body, nil)
+}
+
+func (f hclFormat) Encode(data map[string]interface{}) ([]byte, error) {
+	return f.EncodeLabels(data, nil)
+}
+
+// EncodeLabels is like Encode, except that the blocks at the keys in labels
+// are written with that many labels, taken from the keys of the nested maps.
+func (hclFormat) EncodeLabels(data map[string]interface{}, labels map[string]int) ([]byte, error) {
+	file := hclwrite.NewEmptyFile()
+	if err := writeHCLBody(file.Body(), data, nil, labels); err != nil {
+		return nil, fmt.Errorf("failed to write HCL data: %w", err)
+	}
+	return file.Bytes(), nil
+}
+
+// Labels reports the number of labels of the blocks at each key of data, so
+// that service "web" { ... } yields service: 1.
+func (hclFormat) Labels(data []byte) map[string]int {
+	body, err := parseHCL(data)
+	if err != nil {
+		return nil
+	}
+	labels := make(map[string]int)
+	hclBodyLabels(body, nil, labels)
+	return labels
+}
+
+// Patch edits original through its syntax tree, so that comments, attribute
+// order and block labels survive. Changed attributes are replaced in place,
+// removed attributes and blocks are dropped, and new keys are appended to their
+// block in sorted order.
+func (f hclFormat) Patch(original []byte, data map[string]interface{}) ([]byte, error) {
+	current, err := f.Decode(original)
+	if err != nil {
+		return nil, err
+	}
+	file, diags := hclwrite.ParseConfig(original, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse HCL data: %w", diags)
+	}
+	if err := patchHCLBody(file.Body(), current, data, nil); err != nil {
+		return nil, err
+	}
+	return file.Bytes(), nil
+}
+
+func (hclFormat) KeyLines(data []byte) map[string]int {
+	body, err := parseHCL(data)
+	if err != nil {
+		return nil
+	}
+	lines := make(map[string]int)
+	hclBodyLines(body, nil, lines)
+	return lines
+}
+
+// Detect recognises HCL documents by parsing them. Documents made only of
+// attributes may also be valid TOML, so blocks are needed for a confident guess.
+func (hclFormat) Detect(data []byte) float64 {
+	body, err := parseHCL(data)
+	if err != nil || len(body.Attributes)+len(body.Blocks) == 0 {
+		return 0
+	}
+	if len(body.Blocks) == 0 {
+		return 0.4
+	}
+	confidence := 0.8
+	for _, block := range body.Blocks {
+		if len(block.Labels) > 0 {
+			confidence = 0.9
+		}
+	}
+	return confidence
+}
+
+func parseHCL(data []byte) (*hclsyntax.Body, error) {
+	file, diags := hclsyntax.ParseConfig(data, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse HCL data: %w", diags)
+	}
+	return file.Body.(*hclsyntax.Body), nil
+}
+
+// decodeHCLBody decodes the attributes and blocks of body, which lies at path.
+func decodeHCLBody(body *hclsyntax.Body, path []string) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(body.Attributes)+len(body.Blocks))
+	for name, attr := range body.Attributes {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to parse HCL data: %w", diags)
+		}
+		v, err := hclGoValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse HCL data: attribute %s: %w", strings.Join(append(path, name), "."), err)
+		}
+		result[name] = v
+	}
+
+	repeated := make(map[string]int)
+	for _, block := range body.Blocks {
+		repeated[strings.Join(append([]string{block.Type}, block.Labels...), "\x00")]++
+	}
+	for _, block := range body.Blocks {
+		blockPath := append([]string{block.Type}, block.Labels...)
+		content, err := decodeHCLBody(block.Body, append(append([]string(nil), path...), blockPath...))
+		if err != nil {
+			return nil, err
+		}
+
+		m := result
+		for i, segment := range blockPath {
+			if i == len(blockPath)-1 {
+				if repeated[strings.Join(blockPath, "\x00")] > 1 {
+					list, _ := m[segment].([]interface{})
+					m[segment] = append(list, content)
+				} else if _, exists := m[segment]; exists {
+					return nil, hclConflict(path, blockPath[:i+1])
+				} else {
+					m[segment] = content
+				}
+				break
+			}
+			if _, exists := m[segment]; !exists {
+				m[segment] = make(map[string]interface{})
+			}
+			nested, ok := m[segment].(map[string]interface{})
+			if !ok {
+				return nil, hclConflict(path, blockPath[:i+1])
+			}
+			m = nested
+		}
+	}
+	return result, nil
+}
+
+// hclBodyLabels records the number of labels of the blocks of body, which lies at path.
+func hclBodyLabels(body *hclsyntax.Body, path []string, labels map[string]int) {
+	for _, block := range body.Blocks {
+		typePath := append(append([]string(nil), path...), block.Type)
+		if len(block.Labels) > 0 {
+			labels[internal.JoinSegments(typePath, internal.DefaultDelimiter)] = len(block.Labels)
+		}
+		hclBodyLabels(block.Body, append(typePath, block.Labels...), labels)
+	}
+}
+
+// hclConflict reports a block at path that collides with an attribute or block already defined there.
+func hclConflict(prefix, path []string) error {
+	key := internal.JoinSegments(append(append([]string(nil), prefix...), path...), internal.DefaultDelimiter)
+	return fmt.Errorf("failed to parse HCL data: %w", &internal.ConflictError{Paths: []string{key}})
+}
+
+// hclBodyLines records the line of each attribute, block and object key of body, which lies at path.
+func hclBodyLines(body *hclsyntax.Body, path []string, lines map[string]int) {
+	for name, attr := range body.Attributes {
+		attrPath := append(append([]string(nil), path...), name)
+		lines[internal.JoinSegments(attrPath, internal.DefaultDelimiter)] = attr.NameRange.Start.Line
+		hclObjectLines(attr.Expr, attrPath, lines)
+	}
+	for _, block := range body.Blocks {
+		blockPath := append(append([]string(nil), path...), block.Type)
+		blockPath = append(blockPath, block.Labels...)
+		lines[internal.JoinSegments(blockPath, internal.DefaultDelimiter)] = block.TypeRange.Start.Line
+		hclBodyLines(block.Body, blockPath, lines)
+	}
+}
+
+func hclObjectLines(expr hclsyntax.Expression, path []string, lines map[string]int) {
+	object, ok := expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return
+	}
+	for _, item := range object.Items {
+		key, diags := item.KeyExpr.Value(nil)
+		if diags.HasErrors() || key.Type() != cty.String || key.IsNull() {
+			continue
+		}
+		itemPath := append(append([]string(nil), path...), key.AsString())
+		lines[internal.JoinSegments(itemPath, internal.DefaultDelimiter)] = item.KeyExpr.Range().Start.Line
+		hclObjectLines(item.ValueExpr, itemPath, lines)
+	}
+}
+
+// hclGoValue converts a cty value to the plain Go value stored in the
+// configuration. Whole numbers become int64 and other numbers float64.
+func hclGoValue(v cty.Value) (interface{}, error) {
+	if v.IsNull() {
+		return nil, nil
+	}
+	if !v.IsWhollyKnown() {
+		return nil, fmt.Errorf("value is not known")
+	}
+	ty := v.Type()
+	switch {
+	case ty == cty.String:
+		return v.AsString(), nil
+	case ty == cty.Bool:
+		return v.True(), nil
+	case ty == cty.Number:
+		bf := v.AsBigFloat()
+		if bf.IsInt() {
+			if i, acc := bf.Int64(); acc == big.Exact {
+				return i, nil
+			}
+		}
+		f, _ := bf.Float64()
+		return f, nil
+	case ty.IsListType() || ty.IsTupleType() || ty.IsSetType():
+		list := make([]interface{}, 0, v.LengthInt())
+		for it := v.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			value, err := hclGoValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case ty.IsMapType() || ty.IsObjectType():
+		m := make(map[string]interface{}, v.LengthInt())
+		for it := v.ElementIterator(); it.Next(); {
+			key, elem := it.Element()
+			value, err := hclGoValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			m[key.AsString()] = value
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %s", ty.FriendlyName())
+}
+
+// hclValue converts a Go value to a cty value. Values of types HCL has no
+// literal for are written as strings.
+func hclValue(v interface{}) (cty.Value, error) {
+	switch t := v.(type) {
+	case nil:
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	case fmt.Stringer:
+		return cty.StringVal(t.String()), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return cty.StringVal(rv.String()), nil
+	case reflect.Bool:
+		return cty.BoolVal(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cty.NumberIntVal(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cty.NumberUIntVal(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return cty.NumberFloatVal(rv.Float()), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Len() == 0 {
+			return cty.EmptyTupleVal, nil
+		}
+		elems := make([]cty.Value, rv.Len())
+		for i := range elems {
+			elem, err := hclValue(rv.Index(i).Interface())
+			if err != nil {
+				return cty.NilVal, err
+			}
+			elems[i] = elem
+		}
+		return cty.TupleVal(elems), nil
+	case reflect.Map:
+		if rv.Len() == 0 {
+			return cty.EmptyObjectVal, nil
+		}
+		attrs := make(map[string]cty.Value, rv.Len())
+		for _, key := range rv.MapKeys() {
+			elem, err := hclValue(rv.MapIndex(key).Interface())
+			if err != nil {
+				return cty.NilVal, err
+			}
+			attrs[fmt.Sprint(key.Interface())] = elem
+		}
+		return cty.ObjectVal(attrs), nil
+	}
+	return cty.StringVal(fmt.Sprint(v)), nil
+}
+
+// hclBlocks returns the bodies of the blocks v is written as: one for a map
+// whose keys are all identifiers, one per element for a list of such maps, and
+// none if v is written as an attribute.
+func hclBlocks(v interface{}) []map[string]interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if hclIdentifiers(t) {
+			return []map[string]interface{}{t}
+		}
+	case []interface{}:
+		bodies := make([]map[string]interface{}, 0, len(t))
+		for _, elem := range t {
+			m, ok := elem.(map[string]interface{})
+			if !ok || !hclIdentifiers(m) {
+				return nil
+			}
+			bodies = append(bodies, m)
+		}
+		return bodies
+	}
+	return nil
+}
+
+// hclBlock is a block to write: its labels and its body.
+type hclBlock struct {
+	labels []string
+	body   map[string]interface{}
+}
+
+// hclLabeledBlocks returns the blocks v is written as when they have n labels:
+// the keys of the first n levels of maps are the labels, and each value below
+// them is written as hclBlocks does. It returns nil if v does not nest that deep.
+func hclLabeledBlocks(v interface{}, n int) []hclBlock {
+	if n == 0 {
+		bodies := hclBlocks(v)
+		if bodies == nil {
+			return nil
+		}
+		blocks := make([]hclBlock, 0, len(bodies))
+		for _, body := range bodies {
+			blocks = append(blocks, hclBlock{body: body})
+		}
+		return blocks
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return nil
+	}
+	var blocks []hclBlock
+	for _, label := range sortedKeys(m) {
+		inner := hclLabeledBlocks(m[label], n-1)
+		if inner == nil {
+			return nil
+		}
+		for _, b := range inner {
+			blocks = append(blocks, hclBlock{labels: append([]string{label}, b.labels...), body: b.body})
+		}
+	}
+	return blocks
+}
+
+func hclIdentifiers(m map[string]interface{}) bool {
+	for k := range m {
+		if !hclsyntax.ValidIdentifier(k) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeHCLBody writes data into body, which lies at path: attributes first,
+// then blocks, each in sorted order. Blocks at the keys in labels are written
+// with that many labels where their content nests deep enough.
+func writeHCLBody(body *hclwrite.Body, data map[string]interface{}, path []string, labels map[string]int) error {
+	keys := sortedKeys(data)
+	blocks := make(map[string][]hclBlock, len(keys))
+	for _, k := range keys {
+		n := labels[internal.JoinSegments(append(append([]string(nil), path...), k), internal.DefaultDelimiter)]
+		if blocks[k] = hclLabeledBlocks(data[k], n); blocks[k] == nil {
+			blocks[k] = hclLabeledBlocks(data[k], 0)
+		}
+		if blocks[k] == nil {
+			if err := setHCLAttribute(body, k, data[k], path); err != nil {
+				return err
+			}
+		}
+	}
+	for _, k := range keys {
+		for _, b := range blocks[k] {
+			if err := appendHCLBlock(body, k, b, path, labels); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func setHCLAttribute(body *hclwrite.Body, name string, v interface{}, path []string) error {
+	if !hclsyntax.ValidIdentifier(name) {
+		return fmt.Errorf("key %s is not a valid HCL identifier", strings.Join(append(path, name), "."))
+	}
+	value, err := hclValue(v)
+	if err != nil {
+		return err
+	}
+	body.SetAttributeValue(name, value)
+	return nil
+}
+
+func appendHCLBlock(body *hclwrite.Body, name string, b hclBlock, path []string, labels map[string]int) error {
+	if len(body.Attributes())+len(body.Blocks()) > 0 {
+		body.AppendNewline()
+	}
+	block := body.AppendNewBlock(name, b.labels)
+	blockPath := append(append(append([]string(nil), path...), name), b.labels...)
+	return writeHCLBody(block.Body(), b.body, blockPath, labels)
+}
+
+// patchHCLBody edits body, which lies at path and held current, so that it holds data.
+func patchHCLBody(body *hclwrite.Body, current, data map[string]interface{}, path []string) error {
+	handled := make(map[string]bool)
+	for name := range body.Attributes() {
+		handled[name] = true
+		want, ok := data[name]
+		if !ok {
+			body.RemoveAttribute(name)
+			continue
+		}
+		if !sameHCLValue(current[name], want) {
+			if err := setHCLAttribute(body, name, want, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Labeled blocks nest their content below their labels: the number of
+	// labels of each block type and the first labels in use are tracked to add
+	// new labeled blocks alongside.
+	labels := make(map[string]int)
+	covered := make(map[string]bool)
+	for _, block := range body.Blocks() {
+		blockPath := append([]string{block.Type()}, block.Labels()...)
+		handled[block.Type()] = true
+		labels[block.Type()] = len(block.Labels())
+		if len(blockPath) > 1 {
+			covered[blockPath[0]+"\x00"+blockPath[1]] = true
+		}
+
+		old, _ := lookupHCLPath(current, blockPath)
+		want, ok := lookupHCLPath(data, blockPath)
+		if !ok {
+			body.RemoveBlock(block)
+			continue
+		}
+		oldMap, oldIsMap := old.(map[string]interface{})
+		wantMap, wantIsMap := want.(map[string]interface{})
+		switch {
+		case !oldIsMap:
+			// Repeated blocks are kept as written while their content is unchanged.
+			if !sameHCLValue(old, want) {
+				return fmt.Errorf("cannot patch repeated block %s in place", strings.Join(append(path, blockPath...), "."))
+			}
+		case !wantIsMap || !hclIdentifiers(wantMap):
+			return fmt.Errorf("cannot patch block %s in place", strings.Join(append(path, blockPath...), "."))
+		default:
+			if err := patchHCLBody(block.Body(), oldMap, wantMap, append(append([]string(nil), path...), blockPath...)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// New labels of a block type with a single label become new labeled blocks.
+	types := make([]string, 0, len(labels))
+	for blockType, n := range labels {
+		if n > 0 {
+			types = append(types, blockType)
+		}
+	}
+	sort.Strings(types)
+	for _, blockType := range types {
+		n := labels[blockType]
+		want, ok := data[blockType]
+		if !ok {
+			continue
+		}
+		section, ok := want.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("cannot patch block %s in place", strings.Join(append(path, blockType), "."))
+		}
+		for _, label := range sortedKeys(section) {
+			if covered[blockType+"\x00"+label] {
+				continue
+			}
+			content, ok := section[label].(map[string]interface{})
+			if n != 1 || !ok || !hclIdentifiers(content) {
+				return fmt.Errorf("cannot add block %s in place", strings.Join(append(path, blockType, label), "."))
+			}
+			if err := appendHCLBlock(body, blockType, hclBlock{labels: []string{label}, body: content}, path, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	var added []string
+	for k := range data {
+		if !handled[k] {
+			added = append(added, k)
+		}
+	}
+	sort.Strings(added)
+	separated := len(body.Blocks()) == 0
+	for _, k := range added {
+		if hclBlocks(data[k]) != nil {
+			continue
+		}
+		// Attributes appended after the last block are set apart from it.
+		if !separated {
+			body.AppendNewline()
+			separated = true
+		}
+		if err := setHCLAttribute(body, k, data[k], path); err != nil {
+			return err
+		}
+	}
+	for _, k := range added {
+		for _, b := range hclLabeledBlocks(data[k], 0) {
+			if err := appendHCLBlock(body, k, b, path, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookupHCLPath returns the value at path within data.
+func lookupHCLPath(data map[string]interface{}, path []string) (interface{}, bool) {
+	var v interface{} = data
+	for _, segment := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[segment]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// sameHCLValue reports whether a and b are written identically.
+func sameHCLValue(a, b interface{}) bool {
+	va, errA := hclValue(a)
+	vb, errB := hclValue(b)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return string(hclwrite.TokensForValue(va).Bytes()) == string(hclwrite.TokensForValue(vb).Bytes())
+}
+
+// HCLConfig handles HCL configuration.
+type HCLConfig struct {
+	Data map[string]interface{}
+
+	lines  map[string]int
+	labels map[string]int
+}
+
+// Load loads HCL configuration data.
+func (hc *HCLConfig) Load(data []byte) error {
+	temp, err := HCL.Decode(data)
+	if err != nil {
+		return err
+	}
+	hc.Data = internal.Flatten(temp)
+	hc.lines = KeyLines(HCL, data)
+	hc.labels = Labels(HCL, data)
+	return nil
+}
+
+// Save saves HCL configuration data.
+func (hc *HCLConfig) Save() ([]byte, error) {
+	data, err := internal.Unflatten(hc.Data)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeLabels(HCL, data, hc.labels)
+}
+
+// GetData retrieves the configuration data from HCLConfig.
+func (hc *HCLConfig) GetData() map[string]interface{} {
+	return hc.Data
+}
+
+// KeyLines reports the line on which each key was defined in the last loaded document.
+func (hc *HCLConfig) KeyLines() map[string]int {
+	return hc.lines
+}
+
+// Labels reports the number of labels of the blocks at each key of the last
+// loaded document. Save writes those blocks back with their labels.
+func (hc *HCLConfig) Labels() map[string]int {
+	return hc.labels
+}
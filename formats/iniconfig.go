@@ -3,50 +3,68 @@ package formats
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/1broseidon/configmanager/internal"
 	"gopkg.in/ini.v1"
 )
 
-// INIConfig handles INI configuration.
-type INIConfig struct {
-	Data map[string]interface{}
-}
+// INI is the built-in INI format. Keys in the default section become top-level
+// keys and keys in a named section are nested under the section name. Section
+// and key names are dotted paths, so port in [server.http] is the key
+// server.http.port, and nested maps below a section are written with dotted key
+// names. A key may hold a value and have keys below it.
+var INI Format = iniFormat{}
 
-// Load loads INI configuration data.
-func (ic *INIConfig) Load(data []byte) error {
+type iniFormat struct{}
+
+// iniFlattener flattens the nested maps of the INI format.
+var iniFlattener = Flattener(INI, internal.DefaultDelimiter, false)
+
+func (iniFormat) Name() string         { return "ini" }
+func (iniFormat) Extensions() []string { return []string{".ini"} }
+func (iniFormat) MIMETypes() []string  { return []string{"text/x-ini"} }
+func (iniFormat) SectionValues() bool  { return true }
+
+func (iniFormat) Decode(data []byte) (map[string]interface{}, error) {
 	cfg, err := ini.Load(data)
 	if err != nil {
-		return fmt.Errorf("failed to load INI data: %w", err)
+		return nil, fmt.Errorf("failed to load INI data: %w", err)
 	}
 
-	temp := make(map[string]interface{})
+	flat := make(map[string]interface{})
 	for _, section := range cfg.Sections() {
+		name := section.Name()
+		if name == ini.DefaultSection {
+			name = ""
+		}
 		for _, key := range section.Keys() {
-			if section.Name() == ini.DefaultSection {
-				temp[key.Name()] = key.Value()
-			} else {
-				temp[fmt.Sprintf("%s.%s", section.Name(), key.Name())] = key.Value()
+			if k := internal.INIKey(name, key.Name()); k != "" {
+				flat[k] = key.Value()
 			}
 		}
 	}
-	ic.Data = internal.Flatten(temp)
-	return nil
+	return iniFlattener.Unflatten(flat)
 }
 
-// Save saves INI configuration data.
-func (ic *INIConfig) Save() ([]byte, error) {
+func (iniFormat) Encode(data map[string]interface{}) ([]byte, error) {
 	cfg := ini.Empty()
-	unflattenedData := internal.Unflatten(ic.Data)
-	for k, v := range unflattenedData {
-		sectionKey := strings.Split(k, ".")
-		section, key := ini.DefaultSection, sectionKey[0]
-		if len(sectionKey) > 1 {
-			section, key = sectionKey[0], sectionKey[1]
+	values := iniFlattener.Flatten(data)
+	keys := sortedKeys(values)
+	for _, k := range keys {
+		if segments := internal.SplitKey(k, internal.DefaultDelimiter); len(segments) == 1 {
+			cfg.Section(ini.DefaultSection).Key(segments[0]).SetValue(iniValue(values[k]))
+		}
+	}
+	for _, k := range keys {
+		// Keys below a section are written as plain dotted names.
+		if segments := internal.SplitKey(k, internal.DefaultDelimiter); len(segments) > 1 {
+			name := strings.Join(segments[1:], ".")
+			cfg.Section(segments[0]).Key(name).SetValue(iniValue(values[k]))
 		}
-		cfg.Section(section).Key(key).SetValue(fmt.Sprint(v))
 	}
+
 	var buf bytes.Buffer
 	if _, err := cfg.WriteTo(&buf); err != nil {
 		return nil, fmt.Errorf("failed to write INI data: %w", err)
@@ -54,7 +72,98 @@ func (ic *INIConfig) Save() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// Patch replaces the changed values of original line by line, keeping comments and formatting.
+func (f iniFormat) Patch(original []byte, data map[string]interface{}) ([]byte, error) {
+	current, err := f.Decode(original)
+	if err != nil {
+		return nil, err
+	}
+	return internal.PatchINI(internal.LinePatch{
+		Original: original,
+		Current:  iniFlattener.Flatten(current),
+		Data:     iniFlattener.Flatten(data),
+		Render:   func(v interface{}) (string, error) { return iniValue(v), nil },
+	})
+}
+
+func (iniFormat) KeyLines(data []byte) map[string]int {
+	return internal.INIKeyLines(data)
+}
+
+// Detect recognises section headers and key = value lines. Because INI is far
+// more permissive than TOML, it scores below a document that is also valid TOML.
+func (f iniFormat) Detect(data []byte) float64 {
+	st := scanStats(data)
+	if st.total == 0 || st.sections+st.assigns == 0 {
+		return 0
+	}
+	if _, err := f.Decode(data); err != nil {
+		return 0
+	}
+	confidence := 0.2 + 0.5*st.ratio(st.sections+st.assigns+st.colons)
+	if st.semiComment > 0 {
+		confidence += 0.1
+	}
+	return confidence
+}
+
+// iniValue renders a value as an INI string. Lists are written comma-separated,
+// matching how the typed getters split INI values.
+func iniValue(v interface{}) string {
+	if list, err := internal.ToStringSlice(v); err == nil {
+		if _, isString := v.(string); !isString {
+			return strings.Join(list, ", ")
+		}
+	}
+	if s, err := internal.ToString(v); err == nil {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// INIConfig handles INI configuration.
+type INIConfig struct {
+	Data map[string]interface{}
+
+	lines map[string]int
+}
+
+// Load loads INI configuration data.
+func (ic *INIConfig) Load(data []byte) error {
+	temp, err := INI.Decode(data)
+	if err != nil {
+		return err
+	}
+	ic.Data = iniFlattener.Flatten(temp)
+	ic.lines = KeyLines(INI, data)
+	return nil
+}
+
+// Save saves INI configuration data.
+func (ic *INIConfig) Save() ([]byte, error) {
+	data, err := iniFlattener.Unflatten(ic.Data)
+	if err != nil {
+		return nil, err
+	}
+	return INI.Encode(data)
+}
+
 // GetData retrieves the configuration data from INIConfig.
 func (ic *INIConfig) GetData() map[string]interface{} {
 	return ic.Data
 }
+
+// KeyLines reports the line on which each key was defined in the last loaded document.
+func (ic *INIConfig) KeyLines() map[string]int {
+	return ic.lines
+}
@@ -1,37 +1,417 @@
 package formats
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"strings"
 
 	"github.com/1broseidon/configmanager/internal"
 )
 
+// JSON is the built-in JSON format.
+var JSON Format = jsonFormat{}
+
+type jsonFormat struct{}
+
+func (jsonFormat) Name() string         { return "json" }
+func (jsonFormat) Extensions() []string { return []string{".json"} }
+func (jsonFormat) MIMETypes() []string  { return []string{"application/json", "text/json"} }
+
+func (jsonFormat) Decode(data []byte) (map[string]interface{}, error) {
+	var temp map[string]interface{}
+	if err := json.Unmarshal(data, &temp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON data: %w", err)
+	}
+	return temp, nil
+}
+
+func (jsonFormat) Encode(data map[string]interface{}) ([]byte, error) {
+	out, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON data: %w", err)
+	}
+	return out, nil
+}
+
+// Patch keeps the text of original outside the values that changed: key order,
+// indentation and objects or arrays written on a single line stay as they are.
+// Changed values are replaced in place, written on one line unless they spanned
+// several, removed keys are dropped and new keys are appended to their object in
+// sorted order, laid out like its last member.
+func (jsonFormat) Patch(original []byte, data map[string]interface{}) ([]byte, error) {
+	if !json.Valid(original) {
+		return nil, fmt.Errorf("failed to unmarshal JSON data: invalid JSON document")
+	}
+	start := skipJSONSpace(original, 0)
+	if start == len(original) || original[start] != '{' {
+		return nil, fmt.Errorf("JSON document is not an object")
+	}
+	root, end, err := parseJSONObject(original, start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON data: %w", err)
+	}
+
+	style := jsonStyle{indent: jsonIndent(original), multiline: bytes.ContainsRune(original[start:end], '\n'), colon: root.firstColon()}
+	if style.colon == "" {
+		style.colon = ": "
+	}
+	if err := root.patch(data, style); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	out.Write(original[:start])
+	root.write(&out)
+	out.Write(original[end:])
+	return out.Bytes(), nil
+}
+
+// jsonStyle describes how Patch lays out what it adds to a document.
+type jsonStyle struct {
+	// indent is one level of indentation.
+	indent string
+	// multiline is set when the document puts its members on separate lines.
+	multiline bool
+	// colon is the text between the first key of the document and its value,
+	// used for members added to empty objects.
+	colon string
+}
+
+// jsonObject is a JSON object parsed so that it can be written back byte for
+// byte. The text between its members is kept along with each member.
+type jsonObject struct {
+	members []*jsonMember
+	// trail is the text between the last member, or the opening brace, and the closing brace.
+	trail string
+	// indent is the indentation of the line holding the opening brace.
+	indent string
+}
+
+// jsonMember is a member of a jsonObject, written as lead, key, colon, then
+// value, or child if the value is an object.
+type jsonMember struct {
+	name  string
+	lead  string
+	key   string
+	colon string
+	value string
+	child *jsonObject
+	// sep is the text from the end of the value through the comma after it,
+	// and is empty for the last member.
+	sep string
+}
+
+// parseJSONObject parses the object starting at data[start], which must be
+// valid JSON, and returns it along with the offset just past its closing brace.
+func parseJSONObject(data []byte, start int) (*jsonObject, int, error) {
+	obj := &jsonObject{indent: lineIndent(data, start)}
+	i := start + 1
+	for {
+		keyStart := skipJSONSpace(data, i)
+		if keyStart < len(data) && data[keyStart] == '}' {
+			obj.trail = string(data[i:keyStart])
+			return obj, keyStart + 1, nil
+		}
+		keyEnd := skipJSONValue(data, keyStart)
+		m := &jsonMember{lead: string(data[i:keyStart]), key: string(data[keyStart:keyEnd])}
+		if err := json.Unmarshal(data[keyStart:keyEnd], &m.name); err != nil {
+			return nil, 0, err
+		}
+		colon := skipJSONSpace(data, keyEnd)
+		valueStart := skipJSONSpace(data, colon+1)
+		m.colon = string(data[keyEnd:valueStart])
+
+		valueEnd := 0
+		if data[valueStart] == '{' {
+			child, end, err := parseJSONObject(data, valueStart)
+			if err != nil {
+				return nil, 0, err
+			}
+			m.child, valueEnd = child, end
+		} else {
+			valueEnd = skipJSONValue(data, valueStart)
+			m.value = string(data[valueStart:valueEnd])
+		}
+		obj.members = append(obj.members, m)
+
+		next := skipJSONSpace(data, valueEnd)
+		if next >= len(data) {
+			return nil, 0, fmt.Errorf("unexpected end of JSON object")
+		}
+		if data[next] == '}' {
+			obj.trail = string(data[valueEnd:next])
+			return obj, next + 1, nil
+		}
+		m.sep = string(data[valueEnd : next+1])
+		i = next + 1
+	}
+}
+
+// patch updates obj to hold data. Of members sharing a name, only the last,
+// which is the one a decoder reads, is kept.
+func (obj *jsonObject) patch(data map[string]interface{}, style jsonStyle) error {
+	last := make(map[string]int, len(obj.members))
+	for i, m := range obj.members {
+		last[m.name] = i
+	}
+
+	members := obj.members[:0:0]
+	for i, m := range obj.members {
+		want, ok := data[m.name]
+		if !ok || last[m.name] != i {
+			continue
+		}
+		members = append(members, m)
+
+		if nested, isMap := want.(map[string]interface{}); isMap && m.child != nil {
+			if err := m.child.patch(nested, style); err != nil {
+				return err
+			}
+			continue
+		}
+		if m.child == nil && sameJSONValue(json.RawMessage(m.value), want) {
+			continue
+		}
+		multiline := strings.Contains(m.value, "\n")
+		if m.child != nil {
+			var buf bytes.Buffer
+			m.child.write(&buf)
+			multiline = strings.Contains(buf.String(), "\n")
+		}
+		encoded, err := encodeJSONValue(want, memberIndent(m.lead), style.indent, multiline)
+		if err != nil {
+			return err
+		}
+		m.value, m.child = encoded, nil
+	}
+
+	for _, k := range sortedKeys(data) {
+		if _, ok := last[k]; ok {
+			continue
+		}
+		m, err := obj.newMember(k, data[k], style)
+		if err != nil {
+			return err
+		}
+		members = append(members, m)
+	}
+	// Whatever now comes first takes the place, and so the lead, of the
+	// original first member.
+	if len(members) > 0 && len(obj.members) > 0 && members[0] != obj.members[0] {
+		members[0].lead = obj.members[0].lead
+	}
+	obj.members = members
+	return nil
+}
+
+// newMember returns a member named name holding value, laid out like the last
+// member of obj or, if obj is empty, like the rest of the document.
+func (obj *jsonObject) newMember(name string, value interface{}, style jsonStyle) (*jsonMember, error) {
+	key, err := json.Marshal(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON data: %w", err)
+	}
+	m := &jsonMember{name: name, key: string(key), colon: style.colon}
+	switch {
+	case len(obj.members) > 0:
+		ref := obj.members[len(obj.members)-1]
+		m.lead, m.colon = ref.lead, ref.colon
+	case style.multiline:
+		m.lead = "\n" + obj.indent + style.indent
+		obj.trail = "\n" + obj.indent
+	}
+	multiline := strings.Contains(m.lead, "\n")
+	if m.value, err = encodeJSONValue(value, memberIndent(m.lead), style.indent, multiline); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// firstColon returns the colon of the first member of obj, or "" if obj is empty.
+func (obj *jsonObject) firstColon() string {
+	if len(obj.members) == 0 {
+		return ""
+	}
+	return obj.members[0].colon
+}
+
+// write writes obj to buf, reproducing the original text of unchanged members.
+func (obj *jsonObject) write(buf *bytes.Buffer) {
+	buf.WriteByte('{')
+	for i, m := range obj.members {
+		if i > 0 {
+			if prev := obj.members[i-1]; prev.sep != "" {
+				buf.WriteString(prev.sep)
+			} else {
+				buf.WriteByte(',')
+			}
+		}
+		buf.WriteString(m.lead)
+		buf.WriteString(m.key)
+		buf.WriteString(m.colon)
+		if m.child != nil {
+			m.child.write(buf)
+		} else {
+			buf.WriteString(m.value)
+		}
+	}
+	buf.WriteString(obj.trail)
+	buf.WriteByte('}')
+}
+
+// encodeJSONValue encodes v on a single line or, if multiline is set, indented
+// by indent below a member whose line starts with prefix.
+func encodeJSONValue(v interface{}, prefix, indent string, multiline bool) (string, error) {
+	var encoded []byte
+	var err error
+	if multiline {
+		encoded, err = json.MarshalIndent(v, prefix, indent)
+	} else {
+		encoded, err = json.Marshal(v)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JSON data: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// memberIndent returns the indentation of a member whose text before the key is
+// lead, or "" if the member shares its line with what precedes it.
+func memberIndent(lead string) string {
+	if i := strings.LastIndexByte(lead, '\n'); i >= 0 {
+		return lead[i+1:]
+	}
+	return ""
+}
+
+// lineIndent returns the indentation of the line of data holding offset.
+func lineIndent(data []byte, offset int) string {
+	start := bytes.LastIndexByte(data[:offset], '\n') + 1
+	end := start
+	for end < offset && (data[end] == ' ' || data[end] == '\t') {
+		end++
+	}
+	return string(data[start:end])
+}
+
+// skipJSONSpace returns the offset of the first byte at or after i that is not JSON whitespace.
+func skipJSONSpace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t' || data[i] == '\n' || data[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// skipJSONValue returns the offset just past the value starting at data[i],
+// which must be valid JSON.
+func skipJSONValue(data []byte, i int) int {
+	switch data[i] {
+	case '"':
+		for j := i + 1; j < len(data); j++ {
+			switch data[j] {
+			case '\\':
+				j++
+			case '"':
+				return j + 1
+			}
+		}
+		return len(data)
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(data); j++ {
+			switch data[j] {
+			case '"':
+				j = skipJSONValue(data, j) - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return j + 1
+				}
+			}
+		}
+		return len(data)
+	default:
+		j := i
+		for j < len(data) && !strings.ContainsRune(",}] \t\r\n", rune(data[j])) {
+			j++
+		}
+		return j
+	}
+}
+
+// sameJSONValue reports whether raw holds the same JSON value as v.
+func sameJSONValue(raw json.RawMessage, v interface{}) bool {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	var old, want interface{}
+	if json.Unmarshal(raw, &old) != nil || json.Unmarshal(encoded, &want) != nil {
+		return false
+	}
+	return reflect.DeepEqual(old, want)
+}
+
+// jsonIndent returns the indentation of the first indented line of data, defaulting to two spaces.
+func jsonIndent(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		if trimmed := strings.TrimLeft(line, " \t"); trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
+
+func (jsonFormat) KeyLines(data []byte) map[string]int {
+	return internal.JSONKeyLines(data)
+}
+
+// Detect recognises documents that start with an object and are valid JSON.
+func (jsonFormat) Detect(data []byte) float64 {
+	if !trimmedStartsWith(data, "{") {
+		return 0
+	}
+	if json.Valid(data) {
+		return 1
+	}
+	return 0.4
+}
+
 // JSONConfig handles JSON configuration.
 type JSONConfig struct {
 	Data map[string]interface{}
+
+	lines map[string]int
 }
 
 // Load loads JSON configuration data.
 func (jc *JSONConfig) Load(data []byte) error {
-	var temp map[string]interface{}
-	if err := json.Unmarshal(data, &temp); err != nil {
-		return fmt.Errorf("failed to unmarshal JSON data: %w", err)
+	temp, err := JSON.Decode(data)
+	if err != nil {
+		return err
 	}
 	jc.Data = internal.Flatten(temp)
+	jc.lines = KeyLines(JSON, data)
 	return nil
 }
 
 // Save saves JSON configuration data.
 func (jc *JSONConfig) Save() ([]byte, error) {
-	data, err := json.MarshalIndent(internal.Unflatten(jc.Data), "", "  ")
+	data, err := internal.Unflatten(jc.Data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal JSON data: %w", err)
+		return nil, err
 	}
-	return data, nil
+	return JSON.Encode(data)
 }
 
 // GetData retrieves the configuration data from JSONConfig.
 func (jc *JSONConfig) GetData() map[string]interface{} {
 	return jc.Data
 }
+
+// KeyLines reports the line on which each key was defined in the last loaded document.
+func (jc *JSONConfig) KeyLines() map[string]int {
+	return jc.lines
+}
@@ -0,0 +1,137 @@
+package formats
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/1broseidon/configmanager/internal"
+)
+
+// Properties is the built-in format for Java .properties files. Property keys
+// are dotted names, so database.host=localhost sets the key database.host. A
+// key may hold a value and have keys below it, as in log4j configurations.
+// Every value is read as a string; lists are written comma-separated.
+var Properties Format = propertiesFormat{}
+
+type propertiesFormat struct{}
+
+// propertiesFlattener flattens the nested maps of the properties format.
+var propertiesFlattener = Flattener(Properties, internal.DefaultDelimiter, false)
+
+func (propertiesFormat) Name() string         { return "properties" }
+func (propertiesFormat) Extensions() []string { return []string{".properties"} }
+func (propertiesFormat) MIMETypes() []string  { return []string{"text/x-java-properties"} }
+func (propertiesFormat) SectionValues() bool  { return true }
+
+func (propertiesFormat) Decode(data []byte) (map[string]interface{}, error) {
+	props, err := internal.ParseProperties(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse properties data: %w", err)
+	}
+	flat := make(map[string]interface{}, len(props))
+	for _, p := range props {
+		if key := internal.PropertyKey(p.Key); key != "" {
+			flat[key] = p.Value
+		}
+	}
+	return propertiesFlattener.Unflatten(flat)
+}
+
+func (propertiesFormat) Encode(data map[string]interface{}) ([]byte, error) {
+	values := propertiesFlattener.Flatten(data)
+	var buf bytes.Buffer
+	for _, k := range sortedKeys(values) {
+		name := strings.Join(internal.SplitKey(k, internal.DefaultDelimiter), ".")
+		fmt.Fprintf(&buf, "%s=%s\n", internal.EscapeProperty(name, true), propertiesValue(values[k]))
+	}
+	return buf.Bytes(), nil
+}
+
+// Patch replaces the changed values of original line by line, keeping comments,
+// separators and continued lines whose value is unchanged.
+func (f propertiesFormat) Patch(original []byte, data map[string]interface{}) ([]byte, error) {
+	current, err := f.Decode(original)
+	if err != nil {
+		return nil, err
+	}
+	return internal.PatchProperties(internal.LinePatch{
+		Original: original,
+		Current:  propertiesFlattener.Flatten(current),
+		Data:     propertiesFlattener.Flatten(data),
+		Render:   func(v interface{}) (string, error) { return propertiesValue(v), nil },
+	})
+}
+
+func (propertiesFormat) KeyLines(data []byte) map[string]int {
+	return internal.PropertiesKeyLines(data)
+}
+
+// Detect recognises documents of dotted keys without section headers. Because
+// such a document may also be valid INI, it only scores above INI when most
+// keys are dotted.
+func (propertiesFormat) Detect(data []byte) float64 {
+	if scanStats(data).sections > 0 {
+		return 0
+	}
+	props, err := internal.ParseProperties(data)
+	if err != nil || len(props) == 0 {
+		return 0
+	}
+	dotted := 0
+	for _, p := range props {
+		if strings.Contains(strings.Trim(p.Key, "."), ".") {
+			dotted++
+		}
+	}
+	confidence := 0.3 + 0.5*float64(dotted)/float64(len(props))
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "!") {
+			confidence += 0.1
+			break
+		}
+	}
+	return confidence
+}
+
+// propertiesValue renders a value as an escaped property value.
+func propertiesValue(v interface{}) string {
+	return internal.EscapeProperty(iniValue(v), false)
+}
+
+// PropertiesConfig handles Java properties configuration.
+type PropertiesConfig struct {
+	Data map[string]interface{}
+
+	lines map[string]int
+}
+
+// Load loads properties configuration data.
+func (pc *PropertiesConfig) Load(data []byte) error {
+	temp, err := Properties.Decode(data)
+	if err != nil {
+		return err
+	}
+	pc.Data = propertiesFlattener.Flatten(temp)
+	pc.lines = KeyLines(Properties, data)
+	return nil
+}
+
+// Save saves properties configuration data.
+func (pc *PropertiesConfig) Save() ([]byte, error) {
+	data, err := propertiesFlattener.Unflatten(pc.Data)
+	if err != nil {
+		return nil, err
+	}
+	return Properties.Encode(data)
+}
+
+// GetData retrieves the configuration data from PropertiesConfig.
+func (pc *PropertiesConfig) GetData() map[string]interface{} {
+	return pc.Data
+}
+
+// KeyLines reports the line on which each key was defined in the last loaded document.
+func (pc *PropertiesConfig) KeyLines() map[string]int {
+	return pc.lines
+}
@@ -3,36 +3,144 @@ package formats
 import (
 	"bytes"
 	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 
 	"github.com/1broseidon/configmanager/internal"
 	"github.com/BurntSushi/toml"
 )
 
+// TOML is the built-in TOML format.
+var TOML Format = tomlFormat{}
+
+type tomlFormat struct{}
+
+func (tomlFormat) Name() string         { return "toml" }
+func (tomlFormat) Extensions() []string { return []string{".toml"} }
+func (tomlFormat) MIMETypes() []string  { return []string{"application/toml"} }
+
+func (tomlFormat) Decode(data []byte) (map[string]interface{}, error) {
+	var temp map[string]interface{}
+	if _, err := toml.Decode(string(data), &temp); err != nil {
+		return nil, fmt.Errorf("failed to decode TOML data: %w", err)
+	}
+	return temp, nil
+}
+
+func (tomlFormat) Encode(data map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(data); err != nil {
+		return nil, fmt.Errorf("failed to encode TOML data: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Patch replaces the changed values of original line by line, keeping comments
+// and formatting. The elements of arrays of tables are addressed by index.
+func (f tomlFormat) Patch(original []byte, data map[string]interface{}) ([]byte, error) {
+	current, err := f.Decode(original)
+	if err != nil {
+		return nil, err
+	}
+	return internal.PatchTOML(internal.LinePatch{
+		Original: original,
+		Current:  internal.Flatten(indexTables(current).(map[string]interface{})),
+		Data:     internal.Flatten(indexTables(data).(map[string]interface{})),
+		Render:   tomlValue,
+	})
+}
+
+// indexTables returns v with every array of tables replaced by a map from each
+// index to its table, so that flattening yields keys such as servers.0.host.
+func indexTables(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		m := make(map[string]interface{}, rv.Len())
+		for _, key := range rv.MapKeys() {
+			m[fmt.Sprint(key.Interface())] = indexTables(rv.MapIndex(key).Interface())
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if rv.Len() == 0 {
+			return v
+		}
+		m := make(map[string]interface{}, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			element := rv.Index(i).Interface()
+			if reflect.ValueOf(element).Kind() != reflect.Map {
+				return v
+			}
+			m[strconv.Itoa(i)] = indexTables(element)
+		}
+		return m
+	}
+	return v
+}
+
+// tomlValue renders v as the right-hand side of a TOML assignment.
+func tomlValue(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(map[string]interface{}{"v": v}); err != nil {
+		return "", err
+	}
+	value, ok := strings.CutPrefix(strings.TrimSuffix(buf.String(), "\n"), "v = ")
+	if !ok || strings.Contains(value, "\n") {
+		return "", fmt.Errorf("%T cannot be written as a single TOML value", v)
+	}
+	return value, nil
+}
+
+func (tomlFormat) KeyLines(data []byte) map[string]int {
+	return internal.TOMLKeyLines(data)
+}
+
+// Detect recognises documents made of table headers and key = value lines that decode as TOML.
+func (f tomlFormat) Detect(data []byte) float64 {
+	st := scanStats(data)
+	if st.total == 0 || st.sections+st.assigns == 0 {
+		return 0
+	}
+	if _, err := f.Decode(data); err != nil {
+		return 0
+	}
+	return 0.3 + 0.6*st.ratio(st.sections+st.assigns)
+}
+
 // TOMLConfig handles TOML configuration.
 type TOMLConfig struct {
 	Data map[string]interface{}
+
+	lines map[string]int
 }
 
 // Load loads TOML configuration data.
 func (tc *TOMLConfig) Load(data []byte) error {
-	var temp map[string]interface{}
-	if _, err := toml.Decode(string(data), &temp); err != nil {
-		return fmt.Errorf("failed to decode TOML data: %w", err)
+	temp, err := TOML.Decode(data)
+	if err != nil {
+		return err
 	}
 	tc.Data = internal.Flatten(temp)
+	tc.lines = KeyLines(TOML, data)
 	return nil
 }
 
 // Save saves TOML configuration data.
 func (tc *TOMLConfig) Save() ([]byte, error) {
-	var buf bytes.Buffer
-	if err := toml.NewEncoder(&buf).Encode(internal.Unflatten(tc.Data)); err != nil {
-		return nil, fmt.Errorf("failed to encode TOML data: %w", err)
+	data, err := internal.Unflatten(tc.Data)
+	if err != nil {
+		return nil, err
 	}
-	return buf.Bytes(), nil
+	return TOML.Encode(data)
 }
 
 // GetData retrieves the configuration data from TOMLConfig.
 func (tc *TOMLConfig) GetData() map[string]interface{} {
 	return tc.Data
 }
+
+// KeyLines reports the line on which each key was defined in the last loaded document.
+func (tc *TOMLConfig) KeyLines() map[string]int {
+	return tc.lines
+}
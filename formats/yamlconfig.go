@@ -1,41 +1,299 @@
 package formats
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
+	"strings"
 
 	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
 
 	"github.com/1broseidon/configmanager/internal"
 )
 
+// YAML is the built-in YAML format.
+var YAML Format = yamlFormat{}
+
+type yamlFormat struct{}
+
+func (yamlFormat) Name() string         { return "yaml" }
+func (yamlFormat) Extensions() []string { return []string{".yaml", ".yml"} }
+func (yamlFormat) MIMETypes() []string {
+	return []string{"application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml"}
+}
+
+func (yamlFormat) Decode(data []byte) (map[string]interface{}, error) {
+	var temp map[string]interface{}
+	if err := yaml.Unmarshal(data, &temp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal YAML data: %w", err)
+	}
+	return temp, nil
+}
+
+func (yamlFormat) Encode(data map[string]interface{}) ([]byte, error) {
+	out, err := yaml.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal YAML data: %w", err)
+	}
+	return out, nil
+}
+
+// Patch edits the node tree of original, so that comments, key order, quoting
+// and anchors survive. Changed values are replaced in place, removed keys are
+// dropped and new keys are appended to their mapping in sorted order.
+func (yamlFormat) Patch(original []byte, data map[string]interface{}) ([]byte, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(original, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal YAML data: %w", err)
+	}
+	if doc.Kind != yamlv3.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return nil, fmt.Errorf("YAML document is not a mapping")
+	}
+	if err := patchYAMLMapping(doc.Content[0], data); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := yamlv3.NewEncoder(&buf)
+	enc.SetIndent(yamlIndent(original))
+	if err := enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to marshal YAML data: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to marshal YAML data: %w", err)
+	}
+
+	// The node tree does not record blank lines; put them back unless that
+	// would change the content, as inside a literal block scalar.
+	patched := buf.Bytes()
+	if spaced := restoreBlankLines(original, patched); sameContent(YAML, spaced, patched) {
+		return spaced, nil
+	}
+	return patched, nil
+}
+
+// restoreBlankLines inserts a blank line into patched before each line that
+// follows a blank line in original, matching lines in order.
+func restoreBlankLines(original, patched []byte) []byte {
+	out := strings.Split(string(patched), "\n")
+	result := make([]string, 0, len(out))
+	next := 0
+	blank := false
+	for _, line := range strings.Split(string(original), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			blank = true
+			continue
+		}
+		for i := next; i < len(out); i++ {
+			if out[i] != line {
+				continue
+			}
+			result = append(result, out[next:i]...)
+			if blank && len(result) > 0 && result[len(result)-1] != "" {
+				result = append(result, "")
+			}
+			next = i
+			break
+		}
+		blank = false
+	}
+	result = append(result, out[next:]...)
+	return []byte(strings.Join(result, "\n"))
+}
+
+func patchYAMLMapping(node *yamlv3.Node, data map[string]interface{}) error {
+	seen := make(map[string]bool)
+	content := make([]*yamlv3.Node, 0, len(node.Content))
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Tag == "!!merge" {
+			content = append(content, key, value)
+			continue
+		}
+		want, ok := data[key.Value]
+		if !ok {
+			continue
+		}
+		seen[key.Value] = true
+
+		if err := patchYAMLValue(value, want); err != nil {
+			return err
+		}
+		content = append(content, key, value)
+	}
+
+	for _, k := range sortedKeys(data) {
+		if seen[k] {
+			continue
+		}
+		value, err := yamlNode(data[k])
+		if err != nil {
+			return err
+		}
+		content = append(content, &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: k}, value)
+	}
+	node.Content = content
+	return nil
+}
+
+// patchYAMLValue updates node to hold want, descending into mappings and
+// sequences so that the comments and styles of unchanged entries survive.
+func patchYAMLValue(node *yamlv3.Node, want interface{}) error {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		if node.Kind == yamlv3.MappingNode {
+			return patchYAMLMapping(node, want)
+		}
+	case []interface{}:
+		if node.Kind == yamlv3.SequenceNode {
+			return patchYAMLSequence(node, want)
+		}
+	}
+
+	same, err := sameYAMLValue(node, want)
+	if err != nil || same {
+		return err
+	}
+	replacement, err := yamlNode(want)
+	if err != nil {
+		return err
+	}
+	if node.Kind == yamlv3.ScalarNode && replacement.Kind == yamlv3.ScalarNode && node.ShortTag() == replacement.ShortTag() {
+		replacement.Style = node.Style
+	}
+	replacement.Anchor = node.Anchor
+	replacement.HeadComment = node.HeadComment
+	replacement.LineComment = node.LineComment
+	replacement.FootComment = node.FootComment
+	*node = *replacement
+	return nil
+}
+
+// patchYAMLSequence updates the elements of node in place, dropping those past
+// the end of want and appending any new ones.
+func patchYAMLSequence(node *yamlv3.Node, want []interface{}) error {
+	if len(node.Content) > len(want) {
+		node.Content = node.Content[:len(want)]
+	}
+	for i, v := range want {
+		if i < len(node.Content) {
+			if err := patchYAMLValue(node.Content[i], v); err != nil {
+				return err
+			}
+			continue
+		}
+		element, err := yamlNode(v)
+		if err != nil {
+			return err
+		}
+		node.Content = append(node.Content, element)
+	}
+	return nil
+}
+
+// sameYAMLValue reports whether node decodes to the same value as v.
+func sameYAMLValue(node *yamlv3.Node, v interface{}) (bool, error) {
+	var old interface{}
+	if err := node.Decode(&old); err != nil {
+		return false, err
+	}
+	encoded, err := yamlNode(v)
+	if err != nil {
+		return false, err
+	}
+	var want interface{}
+	if err := encoded.Decode(&want); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(old, want), nil
+}
+
+func yamlNode(v interface{}) (*yamlv3.Node, error) {
+	var node yamlv3.Node
+	if err := node.Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to marshal YAML data: %w", err)
+	}
+	return &node, nil
+}
+
+// yamlIndent returns the smallest indentation used by a nested mapping key or
+// sequence entry in data, defaulting to two spaces.
+func yamlIndent(data []byte) int {
+	indent := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		n := len(line) - len(trimmed)
+		if n == 0 || trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if indent == 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent < 2 {
+		return 2
+	}
+	return indent
+}
+
+func (yamlFormat) KeyLines(data []byte) map[string]int {
+	return internal.YAMLKeyLines(data)
+}
+
+// Detect recognises block-style mappings. Flow-style documents starting with a
+// brace are left to JSON, which they almost always are.
+func (f yamlFormat) Detect(data []byte) float64 {
+	if trimmedStartsWith(data, "{") || trimmedStartsWith(data, "[") {
+		return 0.1
+	}
+	st := scanStats(data)
+	if st.total == 0 || st.sections > 0 {
+		return 0
+	}
+	score := st.ratio(st.yamlKeys + st.yamlItems)
+	if _, err := f.Decode(data); err != nil {
+		return 0.3 * score
+	}
+	return 0.3 + 0.6*score
+}
+
 // YAMLConfig handles YAML configuration.
 type YAMLConfig struct {
 	Data map[string]interface{}
+
+	lines map[string]int
 }
 
 // Load loads YAML configuration data.
 func (yc *YAMLConfig) Load(data []byte) error {
-	var temp map[string]interface{}
-	if err := yaml.Unmarshal(data, &temp); err != nil {
-		return fmt.Errorf("failed to unmarshal YAML data: %w", err)
+	temp, err := YAML.Decode(data)
+	if err != nil {
+		return err
 	}
 
 	yc.Data = internal.Flatten(temp)
+	yc.lines = KeyLines(YAML, data)
 
 	return nil
 }
 
 // Save saves YAML configuration data.
 func (yc *YAMLConfig) Save() ([]byte, error) {
-	unflattenedData := internal.Unflatten(yc.Data)
-	data, err := yaml.Marshal(unflattenedData)
+	data, err := internal.Unflatten(yc.Data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal YAML data: %w", err)
+		return nil, err
 	}
-	return data, nil
+	return YAML.Encode(data)
 }
 
 // GetData retrieves the configuration data from YAMLConfig.
 func (yc *YAMLConfig) GetData() map[string]interface{} {
 	return yc.Data
 }
+
+// KeyLines reports the line on which each key was defined in the last loaded document.
+func (yc *YAMLConfig) KeyLines() map[string]int {
+	return yc.lines
+}
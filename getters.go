@@ -0,0 +1,209 @@
+package configmanager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/1broseidon/configmanager/internal"
+)
+
+// ErrKeyNotFound is returned by the typed getters when a key is not present in the configuration.
+var ErrKeyNotFound = errors.New("key not found")
+
+// get looks up a single flattened key.
+func (cm *ConfigManager) get(key string) (interface{}, error) {
+	value, ok := cm.current().data[cm.normalize(key)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+	return value, nil
+}
+
+// section looks up the value or section rooted at key.
+func (cm *ConfigManager) section(key string) (interface{}, error) {
+	value, ok, err := cm.current().lookup(cm.normalize(key), cm.flattener())
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read section %s: %w", key, err)
+	}
+	return internal.Copy(value), nil
+}
+
+// convertErr wraps a conversion failure with the key it occurred on.
+func convertErr(key string, err error) error {
+	return fmt.Errorf("invalid value for key %s: %w", key, err)
+}
+
+// GetString returns the value of key converted to a string.
+func (cm *ConfigManager) GetString(key string) (string, error) {
+	value, err := cm.get(key)
+	if err != nil {
+		return "", err
+	}
+	s, err := internal.ToString(value)
+	if err != nil {
+		return "", convertErr(key, err)
+	}
+	return s, nil
+}
+
+// GetInt returns the value of key converted to an int.
+func (cm *ConfigManager) GetInt(key string) (int, error) {
+	value, err := cm.get(key)
+	if err != nil {
+		return 0, err
+	}
+	i, err := internal.ToInt(value)
+	if err != nil {
+		return 0, convertErr(key, err)
+	}
+	return i, nil
+}
+
+// GetInt64 returns the value of key converted to an int64.
+func (cm *ConfigManager) GetInt64(key string) (int64, error) {
+	value, err := cm.get(key)
+	if err != nil {
+		return 0, err
+	}
+	i, err := internal.ToInt64(value)
+	if err != nil {
+		return 0, convertErr(key, err)
+	}
+	return i, nil
+}
+
+// GetFloat64 returns the value of key converted to a float64.
+func (cm *ConfigManager) GetFloat64(key string) (float64, error) {
+	value, err := cm.get(key)
+	if err != nil {
+		return 0, err
+	}
+	f, err := internal.ToFloat64(value)
+	if err != nil {
+		return 0, convertErr(key, err)
+	}
+	return f, nil
+}
+
+// GetBool returns the value of key converted to a bool.
+func (cm *ConfigManager) GetBool(key string) (bool, error) {
+	value, err := cm.get(key)
+	if err != nil {
+		return false, err
+	}
+	b, err := internal.ToBool(value)
+	if err != nil {
+		return false, convertErr(key, err)
+	}
+	return b, nil
+}
+
+// GetDuration returns the value of key converted to a time.Duration.
+func (cm *ConfigManager) GetDuration(key string) (time.Duration, error) {
+	value, err := cm.get(key)
+	if err != nil {
+		return 0, err
+	}
+	d, err := internal.ToDuration(value)
+	if err != nil {
+		return 0, convertErr(key, err)
+	}
+	return d, nil
+}
+
+// GetStringSlice returns the value of key converted to a slice of strings. With
+// WithArrayIndexing, key may also name an array whose elements are stored under
+// their indices.
+func (cm *ConfigManager) GetStringSlice(key string) ([]string, error) {
+	value, err := cm.section(key)
+	if err != nil {
+		return nil, err
+	}
+	s, err := internal.ToStringSlice(value)
+	if err != nil {
+		return nil, convertErr(key, err)
+	}
+	return s, nil
+}
+
+// GetStringMap returns the section rooted at key as a nested map. For example,
+// GetStringMap("database") returns the values of every "database.*" key.
+func (cm *ConfigManager) GetStringMap(key string) (map[string]interface{}, error) {
+	value, err := cm.section(key)
+	if err != nil {
+		return nil, err
+	}
+	m, err := internal.ToStringMap(value)
+	if err != nil {
+		return nil, convertErr(key, err)
+	}
+	return m, nil
+}
+
+// GetStringOr returns the value of key as a string, or def if the key is missing or cannot be converted.
+func (cm *ConfigManager) GetStringOr(key string, def string) string {
+	if s, err := cm.GetString(key); err == nil {
+		return s
+	}
+	return def
+}
+
+// GetIntOr returns the value of key as an int, or def if the key is missing or cannot be converted.
+func (cm *ConfigManager) GetIntOr(key string, def int) int {
+	if i, err := cm.GetInt(key); err == nil {
+		return i
+	}
+	return def
+}
+
+// GetInt64Or returns the value of key as an int64, or def if the key is missing or cannot be converted.
+func (cm *ConfigManager) GetInt64Or(key string, def int64) int64 {
+	if i, err := cm.GetInt64(key); err == nil {
+		return i
+	}
+	return def
+}
+
+// GetFloat64Or returns the value of key as a float64, or def if the key is missing or cannot be converted.
+func (cm *ConfigManager) GetFloat64Or(key string, def float64) float64 {
+	if f, err := cm.GetFloat64(key); err == nil {
+		return f
+	}
+	return def
+}
+
+// GetBoolOr returns the value of key as a bool, or def if the key is missing or cannot be converted.
+func (cm *ConfigManager) GetBoolOr(key string, def bool) bool {
+	if b, err := cm.GetBool(key); err == nil {
+		return b
+	}
+	return def
+}
+
+// GetDurationOr returns the value of key as a time.Duration, or def if the key is missing or cannot be converted.
+func (cm *ConfigManager) GetDurationOr(key string, def time.Duration) time.Duration {
+	if d, err := cm.GetDuration(key); err == nil {
+		return d
+	}
+	return def
+}
+
+// GetStringSliceOr returns the value of key as a slice of strings, or def if the key is missing or cannot be converted.
+func (cm *ConfigManager) GetStringSliceOr(key string, def []string) []string {
+	if s, err := cm.GetStringSlice(key); err == nil {
+		return s
+	}
+	return def
+}
+
+// GetStringMapOr returns the section rooted at key as a nested map, or def if the key is missing or cannot be converted.
+func (cm *ConfigManager) GetStringMapOr(key string, def map[string]interface{}) map[string]interface{} {
+	if m, err := cm.GetStringMap(key); err == nil {
+		return m
+	}
+	return def
+}
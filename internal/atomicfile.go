@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic replaces filename with data so that readers and crashes see
+// either the old or the new content, never a partial write. The data is
+// written to a temporary file in the same directory, synced and renamed over
+// filename, and the directory is synced. An existing file keeps its mode and,
+// where permitted, its owner; new files are created with mode 0644. If
+// filename is a symbolic link, the file it points to is replaced.
+//
+// If backups is positive, the previous content is kept as filename.bak, with
+// older copies rotated to filename.bak.1 up to filename.bak.<backups-1>.
+func WriteFileAtomic(filename string, data []byte, backups int) error {
+	target := filename
+	if resolved, err := filepath.EvalSymlinks(filename); err == nil {
+		target = resolved
+	}
+
+	mode := fs.FileMode(0644)
+	info, err := os.Stat(target)
+	switch {
+	case err == nil:
+		mode = info.Mode().Perm()
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	dir := filepath.Dir(target)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(target)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if info != nil {
+		chown(tmp, info)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if info != nil && backups > 0 {
+		if err := rotateBackups(target, backups); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", target, err)
+		}
+	}
+	if err := os.Rename(tmpName, target); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// rotateBackups shifts the existing backups of filename one place down and
+// saves its current content as filename.bak, keeping at most n copies.
+func rotateBackups(filename string, n int) error {
+	name := func(i int) string {
+		if i == 0 {
+			return filename + ".bak"
+		}
+		return fmt.Sprintf("%s.bak.%d", filename, i)
+	}
+
+	if err := os.Remove(name(n - 1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for i := n - 2; i >= 0; i-- {
+		if err := os.Rename(name(i), name(i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	// A hard link keeps the old content once filename is replaced; copy it
+	// on file systems that do not support links.
+	if err := os.Link(filename, name(0)); err == nil {
+		return nil
+	}
+	return copyFile(filename, name(0))
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package internal
+
+import (
+	"io/fs"
+	"os"
+)
+
+// chown is a no-op on platforms without Unix file ownership.
+func chown(*os.File, fs.FileInfo) {}
+
+// syncDir is a no-op on platforms that cannot sync directories.
+func syncDir(string) error { return nil }
@@ -0,0 +1,27 @@
+//go:build unix
+
+package internal
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// chown gives f the owner and group of the file described by info. Failures
+// are ignored: only privileged processes may give files away.
+func chown(f *os.File, info fs.FileInfo) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		_ = f.Chown(int(st.Uid), int(st.Gid))
+	}
+}
+
+// syncDir flushes the directory entry of a renamed file to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
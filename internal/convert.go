@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ToString converts a configuration value to a string.
+func ToString(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case []byte:
+		return string(val), nil
+	case fmt.Stringer:
+		return val.String(), nil
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(val), nil
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case nil:
+		return "", fmt.Errorf("cannot convert nil to string")
+	default:
+		return "", fmt.Errorf("cannot convert %T to string", v)
+	}
+}
+
+// ToInt64 converts a configuration value to an int64. Floats are accepted only
+// when they hold a whole number, so a JSON 8080 (float64) converts cleanly while
+// 1.5 is rejected. Strings are decimal, so "010" is 10, unless they start with
+// a 0x, 0o or 0b prefix.
+func ToInt64(v interface{}) (int64, error) {
+	switch val := v.(type) {
+	case int:
+		return int64(val), nil
+	case int8:
+		return int64(val), nil
+	case int16:
+		return int64(val), nil
+	case int32:
+		return int64(val), nil
+	case int64:
+		return val, nil
+	case uint:
+		return uintToInt64(uint64(val))
+	case uint8:
+		return int64(val), nil
+	case uint16:
+		return int64(val), nil
+	case uint32:
+		return int64(val), nil
+	case uint64:
+		return uintToInt64(val)
+	case float32:
+		return floatToInt64(float64(val))
+	case float64:
+		return floatToInt64(val)
+	case time.Duration:
+		return int64(val), nil
+	case string:
+		s := strings.TrimSpace(val)
+		if i, err := strconv.ParseInt(s, intBase(s), 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse %q as integer", val)
+		}
+		return floatToInt64(f)
+	case nil:
+		return 0, fmt.Errorf("cannot convert nil to integer")
+	default:
+		return 0, fmt.Errorf("cannot convert %T to integer", v)
+	}
+}
+
+// intBase returns the base in which ToInt64 parses s: 0, letting strconv read
+// the base from the prefix, for hexadecimal, octal and binary literals, and 10
+// otherwise, so that leading zeros are not mistaken for an octal prefix.
+func intBase(s string) int {
+	digits := strings.TrimLeft(s, "+-")
+	if len(digits) > 2 && digits[0] == '0' && strings.ContainsRune("xXoObB", rune(digits[1])) {
+		return 0
+	}
+	return 10
+}
+
+// ToInt converts a configuration value to an int, checking for overflow on
+// platforms where int is 32 bits wide.
+func ToInt(v interface{}) (int, error) {
+	i, err := ToInt64(v)
+	if err != nil {
+		return 0, err
+	}
+	if i < math.MinInt || i > math.MaxInt {
+		return 0, fmt.Errorf("value %d overflows int", i)
+	}
+	return int(i), nil
+}
+
+// ToFloat64 converts a configuration value to a float64.
+func ToFloat64(v interface{}) (float64, error) {
+	switch val := v.(type) {
+	case float64:
+		return val, nil
+	case float32:
+		return float64(val), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return reflect.ValueOf(val).Convert(reflect.TypeOf(float64(0))).Float(), nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse %q as float", val)
+		}
+		return f, nil
+	case nil:
+		return 0, fmt.Errorf("cannot convert nil to float")
+	default:
+		return 0, fmt.Errorf("cannot convert %T to float", v)
+	}
+}
+
+// ToBool converts a configuration value to a bool. In addition to the forms
+// accepted by strconv.ParseBool, the INI-style words yes/no and on/off are
+// recognised.
+func ToBool(v interface{}) (bool, error) {
+	switch val := v.(type) {
+	case bool:
+		return val, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(val)) {
+		case "1", "t", "true", "y", "yes", "on":
+			return true, nil
+		case "0", "f", "false", "n", "no", "off":
+			return false, nil
+		}
+		return false, fmt.Errorf("cannot parse %q as bool", val)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		i, _ := ToInt64(val)
+		return i != 0, nil
+	case nil:
+		return false, fmt.Errorf("cannot convert nil to bool")
+	default:
+		return false, fmt.Errorf("cannot convert %T to bool", v)
+	}
+}
+
+// ToDuration converts a configuration value to a time.Duration. Strings are
+// parsed with time.ParseDuration; bare numbers are treated as nanoseconds.
+func ToDuration(v interface{}) (time.Duration, error) {
+	switch val := v.(type) {
+	case time.Duration:
+		return val, nil
+	case string:
+		s := strings.TrimSpace(val)
+		if d, err := time.ParseDuration(s); err == nil {
+			return d, nil
+		}
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse %q as duration", val)
+		}
+		return time.Duration(i), nil
+	case nil:
+		return 0, fmt.Errorf("cannot convert nil to duration")
+	default:
+		i, err := ToInt64(v)
+		if err != nil {
+			return 0, fmt.Errorf("cannot convert %T to duration", v)
+		}
+		return time.Duration(i), nil
+	}
+}
+
+// ToStringSlice converts a configuration value to a slice of strings. Arrays
+// decoded from JSON, YAML or TOML are converted element by element, while plain
+// strings (as produced by INI files and environment variables) are split on
+// commas.
+func ToStringSlice(v interface{}) ([]string, error) {
+	switch val := v.(type) {
+	case []string:
+		return append([]string(nil), val...), nil
+	case string:
+		if strings.TrimSpace(val) == "" {
+			return []string{}, nil
+		}
+		parts := strings.Split(val, ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		return parts, nil
+	case nil:
+		return nil, fmt.Errorf("cannot convert nil to []string")
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("cannot convert %T to []string", v)
+	}
+	result := make([]string, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		s, err := ToString(rv.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		result[i] = s
+	}
+	return result, nil
+}
+
+// ToStringMap converts a map with arbitrary key types, such as the
+// map[interface{}]interface{} values produced by YAML, to a map keyed by strings.
+func ToStringMap(v interface{}) (map[string]interface{}, error) {
+	if m, ok := v.(map[string]interface{}); ok {
+		return m, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map {
+		return nil, fmt.Errorf("cannot convert %T to map[string]interface{}", v)
+	}
+	result := make(map[string]interface{}, rv.Len())
+	for _, key := range rv.MapKeys() {
+		result[fmt.Sprint(key.Interface())] = rv.MapIndex(key).Interface()
+	}
+	return result, nil
+}
+
+func uintToInt64(u uint64) (int64, error) {
+	if u > math.MaxInt64 {
+		return 0, fmt.Errorf("value %d overflows int64", u)
+	}
+	return int64(u), nil
+}
+
+func floatToInt64(f float64) (int64, error) {
+	if f != math.Trunc(f) {
+		return 0, fmt.Errorf("value %v is not a whole number", f)
+	}
+	if f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, fmt.Errorf("value %v overflows int64", f)
+	}
+	return int64(f), nil
+}
@@ -0,0 +1,69 @@
+package internal
+
+import "reflect"
+
+// Copy returns a deep copy of a configuration value: maps and slices, including
+// those nested inside them, are copied, while other values are returned as they are.
+func Copy(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return CopyMap(val)
+	case []interface{}:
+		copied := make([]interface{}, len(val))
+		for i, item := range val {
+			copied[i] = Copy(item)
+		}
+		return copied
+	case nil:
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			copied.Index(i).Set(copyValue(rv.Index(i)))
+		}
+		return copied.Interface()
+	case reflect.Map:
+		if rv.IsNil() {
+			return v
+		}
+		copied := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			copied.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+		}
+		return copied.Interface()
+	default:
+		return v
+	}
+}
+
+// CopyMap returns a deep copy of data. See Copy.
+func CopyMap(data map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		copied[k] = Copy(v)
+	}
+	return copied
+}
+
+// copyValue deep-copies an element of a slice or map, keeping its static type.
+func copyValue(v reflect.Value) reflect.Value {
+	if !v.IsValid() || (v.Kind() == reflect.Interface && v.IsNil()) {
+		return v
+	}
+	copied := reflect.ValueOf(Copy(v.Interface()))
+	if v.Kind() == reflect.Interface {
+		// An interface element holds a dynamic value of any type.
+		result := reflect.New(v.Type()).Elem()
+		result.Set(copied)
+		return result
+	}
+	return copied
+}
@@ -0,0 +1,321 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DotenvVar is a variable assigned in a dotenv document.
+type DotenvVar struct {
+	Name  string
+	Value string
+	// Line is the 1-based line on which the assignment starts.
+	Line int
+}
+
+// dotenvEntry is an assignment together with the text around its value, kept
+// when the value is replaced in place.
+type dotenvEntry struct {
+	DotenvVar
+	// first and last are the 0-based lines the assignment spans.
+	first, last    int
+	prefix, suffix string
+}
+
+// ParseDotenv parses a dotenv document. Each line assigns NAME=value, optionally
+// preceded by export. Values may be unquoted, with a # preceded by whitespace
+// starting a comment; single-quoted, and taken literally; or double-quoted, with
+// backslash escapes. Quoted values may span several lines. Outside single quotes
+// ${NAME}, ${NAME:-default} and $NAME expand to the value of a variable assigned
+// earlier in the document or, failing that, of the environment.
+func ParseDotenv(data []byte) ([]DotenvVar, error) {
+	entries, err := parseDotenv(strings.ReplaceAll(string(data), "\r\n", "\n"))
+	vars := make([]DotenvVar, len(entries))
+	for i, e := range entries {
+		vars[i] = e.DotenvVar
+	}
+	return vars, err
+}
+
+// DotenvKey returns the key set by the variable name: its lower-cased words,
+// separated by underscores or dots, as segments. DATABASE_HOST sets database.host.
+func DotenvKey(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool { return r == '_' || r == '.' })
+	return joinSegments(words)
+}
+
+// DotenvName returns the name of the variable that sets the escaped dotted key:
+// its segments joined with underscores and upper-cased. Any other character
+// that cannot appear in a variable name becomes an underscore.
+func DotenvName(key string) string {
+	name := strings.Join(SplitKey(key, DefaultDelimiter), "_")
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+	return strings.ToUpper(name)
+}
+
+// DotenvKeyLines returns the line number on which each key of a dotenv document
+// is defined. If a variable is assigned more than once, its last assignment is reported.
+func DotenvKeyLines(data []byte) map[string]int {
+	vars, _ := ParseDotenv(data)
+	lines := make(map[string]int)
+	for _, v := range vars {
+		if key := DotenvKey(v.Name); key != "" {
+			lines[key] = v.Line
+		}
+	}
+	return lines
+}
+
+// PatchDotenv rewrites a dotenv document so that it holds p.Data, replacing only
+// the values that changed and keeping comments, order and export prefixes.
+// New variables are appended at the end of the document.
+func PatchDotenv(p LinePatch) ([]byte, error) {
+	return patchLines(p, lineSyntax{
+		parse:  parseDotenvLines,
+		split:  func(key string) (string, string) { return "", key },
+		assign: func(key, value string) string { return DotenvName(key) + "=" + value },
+	})
+}
+
+func parseDotenvLines(lines []string) *lineDoc {
+	doc := &lineDoc{lines: lines, tables: []lineTable{{header: -1, end: -1}}}
+	// Assignments are kept up to the first one that cannot be parsed.
+	entries, _ := parseDotenv(strings.Join(lines, "\n"))
+	for _, e := range entries {
+		key := DotenvKey(e.Name)
+		if key == "" {
+			continue
+		}
+		doc.entries = append(doc.entries, lineEntry{key: key, first: e.first, last: e.last, prefix: e.prefix, suffix: e.suffix})
+		doc.tables[0].end = e.last
+		doc.tables[0].entries++
+	}
+	return doc
+}
+
+type dotenvParser struct {
+	s    string
+	pos  int
+	line int
+	vars map[string]string
+}
+
+func parseDotenv(text string) ([]dotenvEntry, error) {
+	p := &dotenvParser{s: text, vars: make(map[string]string)}
+	var entries []dotenvEntry
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.s) {
+			return entries, nil
+		}
+		if p.s[p.pos] == '#' {
+			p.pos = p.lineEnd()
+			continue
+		}
+		line := p.line + 1
+		e, err := p.assignment()
+		if err != nil {
+			return entries, fmt.Errorf("line %d: %w", line, err)
+		}
+		p.vars[e.Name] = e.Value
+		entries = append(entries, e)
+	}
+}
+
+// assignment parses a NAME=value assignment starting at the current position.
+func (p *dotenvParser) assignment() (dotenvEntry, error) {
+	lineStart := strings.LastIndexByte(p.s[:p.pos], '\n') + 1
+	e := dotenvEntry{first: p.line}
+	e.Line = p.line + 1
+
+	if rest := p.s[p.pos:]; strings.HasPrefix(rest, "export") && len(rest) > 6 && (rest[6] == ' ' || rest[6] == '\t') {
+		p.pos += 6
+		p.skipSpace()
+	}
+	start := p.pos
+	for p.pos < len(p.s) && isDotenvNameChar(p.s[p.pos]) {
+		p.pos++
+	}
+	e.Name = p.s[start:p.pos]
+	if e.Name == "" {
+		return e, fmt.Errorf("expected a variable name, found %q", p.s[p.pos:p.lineEnd()])
+	}
+	p.skipSpace()
+	if p.pos >= len(p.s) || p.s[p.pos] != '=' {
+		return e, fmt.Errorf("expected = after %s", e.Name)
+	}
+	p.pos++
+	p.skipSpace()
+	e.prefix = p.s[lineStart:p.pos]
+
+	var err error
+	switch {
+	case p.pos < len(p.s) && p.s[p.pos] == '\'':
+		e.Value, err = p.singleQuoted()
+	case p.pos < len(p.s) && p.s[p.pos] == '"':
+		e.Value, err = p.doubleQuoted()
+	default:
+		e.Value = p.unquoted()
+	}
+	if err != nil {
+		return e, fmt.Errorf("value of %s: %w", e.Name, err)
+	}
+
+	end := p.lineEnd()
+	rest := p.s[p.pos:end]
+	if trimmed := strings.TrimSpace(rest); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+		return e, fmt.Errorf("unexpected %q after the value of %s", trimmed, e.Name)
+	}
+	e.suffix = rest
+	if strings.TrimSpace(rest) == "" {
+		e.suffix = ""
+	}
+	e.last = p.line
+	p.pos = end
+	return e, nil
+}
+
+func (p *dotenvParser) singleQuoted() (string, error) {
+	end := strings.IndexByte(p.s[p.pos+1:], '\'')
+	if end < 0 {
+		return "", fmt.Errorf("unterminated quoted string")
+	}
+	value := p.s[p.pos+1 : p.pos+1+end]
+	p.line += strings.Count(value, "\n")
+	p.pos += end + 2
+	return value, nil
+}
+
+func (p *dotenvParser) doubleQuoted() (string, error) {
+	var b strings.Builder
+	for i := p.pos + 1; i < len(p.s); i++ {
+		switch c := p.s[i]; c {
+		case '"':
+			p.pos = i + 1
+			return b.String(), nil
+		case '\\':
+			if i+1 == len(p.s) {
+				b.WriteByte(c)
+				continue
+			}
+			i++
+			switch p.s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\', '$':
+				b.WriteByte(p.s[i])
+			case '\n':
+				// A backslash at the end of a line continues the value on the next one.
+				p.line++
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(p.s[i])
+			}
+		case '$':
+			value, n := p.reference(p.s[i:])
+			b.WriteString(value)
+			i += n - 1
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated quoted string")
+}
+
+// unquoted reads a value up to the end of the line or an inline comment.
+func (p *dotenvParser) unquoted() string {
+	end := p.lineEnd()
+	raw := p.s[p.pos:end]
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && (i == 0 || raw[i-1] == ' ' || raw[i-1] == '\t') {
+			raw = raw[:i]
+			break
+		}
+	}
+	raw = strings.TrimRight(raw, " \t")
+	p.pos += len(raw)
+
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '$' {
+			value, n := p.reference(raw[i:])
+			b.WriteString(value)
+			i += n - 1
+			continue
+		}
+		b.WriteByte(raw[i])
+	}
+	return b.String()
+}
+
+// reference expands the variable reference at the start of s, which starts
+// with a $, returning its value and the number of bytes it spans. A $ that
+// starts no reference stands for itself.
+func (p *dotenvParser) reference(s string) (string, int) {
+	if strings.HasPrefix(s, "${") {
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			return "$", 1
+		}
+		name, def, hasDefault := strings.Cut(s[2:end], ":-")
+		if value := p.lookup(name); value != "" || !hasDefault {
+			return value, end + 1
+		}
+		return def, end + 1
+	}
+	n := 1
+	for n < len(s) && (isDotenvNameChar(s[n]) && s[n] != '.') {
+		n++
+	}
+	if n == 1 {
+		return "$", 1
+	}
+	return p.lookup(s[1:n]), n
+}
+
+// lookup returns the value of the variable name assigned earlier in the document or, failing that, of the environment.
+func (p *dotenvParser) lookup(name string) string {
+	if value, ok := p.vars[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+func (p *dotenvParser) lineEnd() int {
+	if i := strings.IndexByte(p.s[p.pos:], '\n'); i >= 0 {
+		return p.pos + i
+	}
+	return len(p.s)
+}
+
+func (p *dotenvParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *dotenvParser) skipBlank() {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+		if p.s[p.pos] == '\n' {
+			p.line++
+		}
+		p.pos++
+	}
+}
+
+func isDotenvNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.'
+}
@@ -3,66 +3,271 @@ package internal
 import (
 	"fmt"
 	"reflect"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 )
 
+// DefaultDelimiter separates the segments of flattened keys unless another delimiter is configured.
+const DefaultDelimiter = "."
+
+// SectionValue is the key under which, with Flattener.SectionValues, a nested
+// map holds the value of its own key.
+const SectionValue = ""
+
+// Flattener converts between nested data and flat maps whose keys are paths.
+type Flattener struct {
+	// Delim separates the segments of flattened keys.
+	Delim string
+	// IndexArrays flattens each element of a slice under its index, as in
+	// servers.0.host, instead of storing the slice as a single value. When
+	// unflattening, maps whose keys are all indices become slices again.
+	IndexArrays bool
+	// Lists, if not nil, records the key of every slice that Flatten stores
+	// element by element. When unflattening, only the maps at those keys
+	// become slices again, so that a map whose keys merely look like indices,
+	// such as HTTP status codes, stays a map. The data passed to
+	// UnflattenValue itself has the key "".
+	Lists map[string]bool
+	// SectionValues lets a key both hold a value and have keys below it, as
+	// a.b and a.b.c may in a properties file. The nested map of such a section
+	// holds its own value under the SectionValue key, which flattens to the
+	// key of the section itself.
+	SectionValues bool
+}
+
 // Flatten converts a nested map or struct into a flat map with dot notation keys.
 func Flatten(data map[string]interface{}) map[string]interface{} {
+	return FlattenWith(data, DefaultDelimiter)
+}
+
+// FlattenWith converts a nested map or struct into a flat map whose keys are
+// joined with delim. Every map key is a single segment and is escaped as needed.
+func FlattenWith(data map[string]interface{}, delim string) map[string]interface{} {
+	return Flattener{Delim: delim}.Flatten(data)
+}
+
+// FlattenPaths is like FlattenWith, except that the top-level keys of data are
+// key paths, which may already be flattened or use bracket syntax.
+func FlattenPaths(data map[string]interface{}, delim string) map[string]interface{} {
+	return Flattener{Delim: delim}.FlattenPaths(data)
+}
+
+// Flatten converts a nested map or struct into a flat map. Every map key is a
+// single segment and is escaped as needed.
+func (f Flattener) Flatten(data map[string]interface{}) map[string]interface{} {
 	result := make(map[string]interface{})
 	for k, v := range data {
-		flatten(v, k, result)
+		f.flatten(v, EscapeSegment(k, f.Delim), result)
 	}
 	return result
 }
 
-// Recursive function to flatten nested maps and structs.
-func flatten(data interface{}, prefix string, result map[string]interface{}) map[string]interface{} {
-	rt := reflect.TypeOf(data)
-	rv := reflect.ValueOf(data)
+// FlattenPaths is like Flatten, except that the top-level keys of data are key
+// paths, which may already be flattened or use bracket syntax.
+func (f Flattener) FlattenPaths(data map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for k, v := range data {
+		f.flatten(v, NormalizeKey(k, f.Delim), result)
+	}
+	return result
+}
 
-	switch rt.Kind() {
-	case reflect.Map:
+// Recursive function to flatten nested maps, structs and, if enabled, slices.
+func (f Flattener) flatten(data interface{}, prefix string, result map[string]interface{}) {
+	join := func(segment string) string {
+		segment = EscapeSegment(segment, f.Delim)
+		if prefix == "" {
+			return segment
+		}
+		return prefix + f.Delim + segment
+	}
+
+	rv := reflect.ValueOf(data)
+	switch {
+	case data == nil:
+	case rv.Kind() == reflect.Map:
 		for _, key := range rv.MapKeys() {
-			strKey := fmt.Sprint(key.Interface())
-			newPrefix := strKey
-			if prefix != "" {
-				newPrefix = prefix + "." + strKey
+			segment := fmt.Sprint(key.Interface())
+			if f.SectionValues && segment == SectionValue && prefix != "" {
+				f.flatten(rv.MapIndex(key).Interface(), prefix, result)
+				continue
 			}
-			flatten(rv.MapIndex(key).Interface(), newPrefix, result)
+			f.flatten(rv.MapIndex(key).Interface(), join(segment), result)
 		}
-	case reflect.Struct:
-		for i := 0; i < rt.NumField(); i++ {
-			field := rt.Field(i)
-			newPrefix := field.Name
-			if prefix != "" {
-				newPrefix = prefix + "." + field.Name
-			}
-			flatten(rv.Field(i).Interface(), newPrefix, result)
+		return
+	case rv.Kind() == reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			f.flatten(rv.Field(i).Interface(), join(rv.Type().Field(i).Name), result)
+		}
+		return
+	case f.IndexArrays && (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Len() > 0:
+		if f.Lists != nil {
+			f.Lists[prefix] = true
 		}
-	default:
-		if prefix != "" {
-			result[prefix] = data
+		for i := 0; i < rv.Len(); i++ {
+			f.flatten(rv.Index(i).Interface(), join(strconv.Itoa(i)), result)
 		}
+		return
+	}
+	if prefix != "" {
+		result[prefix] = data
 	}
-	return result
+}
+
+// ConflictError reports flattened keys that cannot be restored to a nested map
+// together because one is a value and another a section below it, as with a.b
+// and a.b.c.
+type ConflictError struct {
+	// Paths lists every colliding key, sorted.
+	Paths []string
+}
+
+// Error implements the error interface.
+func (ce *ConflictError) Error() string {
+	return fmt.Sprintf("conflicting keys: %s", strings.Join(ce.Paths, ", "))
 }
 
 // Unflatten restores a flat map with dot notation keys to a nested map.
-func Unflatten(data map[string]interface{}) map[string]interface{} {
+func Unflatten(data map[string]interface{}) (map[string]interface{}, error) {
+	return UnflattenWith(data, DefaultDelimiter)
+}
+
+// UnflattenWith restores a flat map whose keys are joined with delim, and
+// escaped as by FlattenWith, to a nested map.
+func UnflattenWith(data map[string]interface{}, delim string) (map[string]interface{}, error) {
+	return Flattener{Delim: delim}.Unflatten(data)
+}
+
+// Unflatten restores a flat map to a nested map. With IndexArrays, nested maps
+// whose keys are all indices, and that are recorded in Lists if it is set,
+// become slices ordered by index. Keys that are
+// both a value and a section are reported as a *ConflictError, unless
+// SectionValues is set.
+func (f Flattener) Unflatten(data map[string]interface{}) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
+	var conflicts [][]string
 	for k, v := range data {
-		keys := strings.Split(k, ".")
+		keys := SplitKey(k, f.Delim)
 		m := result
 		for i, key := range keys {
 			if i == len(keys)-1 {
+				if section, isMap := m[key].(map[string]interface{}); isMap {
+					if f.SectionValues {
+						section[SectionValue] = v
+					} else {
+						conflicts = append(conflicts, keys)
+					}
+					break
+				}
 				m[key] = v
-			} else {
-				if _, ok := m[key]; !ok {
-					m[key] = make(map[string]interface{})
+				break
+			}
+			existing, ok := m[key]
+			if !ok {
+				m[key] = make(map[string]interface{})
+			}
+			nested, isMap := m[key].(map[string]interface{})
+			if !isMap {
+				if !f.SectionValues {
+					conflicts = append(conflicts, keys[:i+1])
+					break
 				}
-				m = m[key].(map[string]interface{})
+				nested = map[string]interface{}{SectionValue: existing}
+				m[key] = nested
 			}
+			m = nested
 		}
 	}
-	return result
+	if len(conflicts) > 0 {
+		return nil, f.conflict(data, conflicts)
+	}
+	if f.IndexArrays {
+		for k, v := range result {
+			result[k] = f.toSlices(v, EscapeSegment(k, f.Delim))
+		}
+	}
+	return result, nil
+}
+
+// UnflattenValue is like Unflatten, except that with IndexArrays the result is
+// itself a slice when the top-level keys of data are all indices.
+func (f Flattener) UnflattenValue(data map[string]interface{}) (interface{}, error) {
+	result, err := f.Unflatten(data)
+	if err != nil || !f.IndexArrays {
+		return result, err
+	}
+	return f.toSlices(result, ""), nil
+}
+
+// ListsUnder returns the keys of lists that lie below prefix, relative to
+// prefix, as UnflattenValue expects them for the section rooted at prefix.
+func ListsUnder(lists map[string]bool, prefix, delim string) map[string]bool {
+	under := make(map[string]bool)
+	for k := range lists {
+		if k == prefix {
+			under[""] = true
+		} else if strings.HasPrefix(k, prefix+delim) {
+			under[strings.TrimPrefix(k, prefix+delim)] = true
+		}
+	}
+	return under
+}
+
+// conflict returns a *ConflictError listing the keys of data that are, or lie
+// below, any of the colliding paths.
+func (f Flattener) conflict(data map[string]interface{}, paths [][]string) error {
+	var colliding []string
+	for k := range data {
+		keys := SplitKey(k, f.Delim)
+		for _, path := range paths {
+			if len(keys) >= len(path) && slices.Equal(keys[:len(path)], path) {
+				colliding = append(colliding, k)
+				break
+			}
+		}
+	}
+	sort.Strings(colliding)
+	return &ConflictError{Paths: colliding}
+}
+
+// toSlices converts v, stored at key, and recursively the maps it holds, into
+// slices where every key of a map is an index and, if Lists is set, the map's
+// key is recorded in it.
+func (f Flattener) toSlices(v interface{}, key string) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	for k, child := range m {
+		childKey := EscapeSegment(k, f.Delim)
+		if key != "" {
+			childKey = key + f.Delim + childKey
+		}
+		m[k] = f.toSlices(child, childKey)
+	}
+	if f.Lists != nil && !f.Lists[key] {
+		return m
+	}
+
+	indices := make([]int, 0, len(m))
+	byIndex := make(map[int]interface{}, len(m))
+	for k, child := range m {
+		i, err := strconv.Atoi(k)
+		if err != nil || i < 0 || strconv.Itoa(i) != k {
+			return m
+		}
+		indices = append(indices, i)
+		byIndex[i] = child
+	}
+	if len(indices) == 0 {
+		return m
+	}
+	sort.Ints(indices)
+	list := make([]interface{}, len(indices))
+	for n, i := range indices {
+		list[n] = byIndex[i]
+	}
+	return list
 }
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Flattened keys join the segments of a path with a delimiter. A segment that
+// itself contains the delimiter, a backslash or an opening bracket has those
+// characters escaped with a backslash, so the YAML key "example.com" below
+// "hosts" becomes hosts.example\.com and is restored as a single key.
+
+// EscapeSegment escapes the characters of segment that SplitKey would otherwise interpret.
+func EscapeSegment(segment, delim string) string {
+	if !strings.ContainsAny(segment, `\[`) && !strings.Contains(segment, delim) {
+		return segment
+	}
+	var b strings.Builder
+	for i := 0; i < len(segment); {
+		if strings.HasPrefix(segment[i:], delim) {
+			for _, r := range delim {
+				b.WriteByte('\\')
+				b.WriteRune(r)
+			}
+			i += len(delim)
+			continue
+		}
+		if segment[i] == '\\' || segment[i] == '[' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(segment[i])
+		i++
+	}
+	return b.String()
+}
+
+// JoinSegments joins the segments of a path into a flattened key, escaping them as needed.
+func JoinSegments(segments []string, delim string) string {
+	escaped := make([]string, len(segments))
+	for i, s := range segments {
+		escaped[i] = EscapeSegment(s, delim)
+	}
+	return strings.Join(escaped, delim)
+}
+
+// SplitKey splits a key path into its segments. Segments are separated by
+// delim, and a backslash escapes the character that follows it. A segment may
+// also be written in brackets, quoted or not, as in hosts["example.com"].port.
+func SplitKey(key, delim string) []string {
+	var segments []string
+	var current strings.Builder
+	// pending is set while current holds a segment that has not been appended.
+	pending := true
+	for i := 0; i < len(key); {
+		switch {
+		case key[i] == '\\' && i+1 < len(key):
+			_, size := utf8.DecodeRuneInString(key[i+1:])
+			current.WriteString(key[i+1 : i+1+size])
+			i += 1 + size
+			pending = true
+		case strings.HasPrefix(key[i:], delim):
+			segments = append(segments, current.String())
+			current.Reset()
+			i += len(delim)
+			pending = true
+		case key[i] == '[':
+			segment, n, ok := parseBracket(key[i:])
+			if !ok {
+				current.WriteByte(key[i])
+				i++
+				pending = true
+				continue
+			}
+			if current.Len() > 0 {
+				segments = append(segments, current.String())
+				current.Reset()
+			}
+			segments = append(segments, segment)
+			i += n
+			if strings.HasPrefix(key[i:], delim) {
+				i += len(delim)
+			} else {
+				pending = false
+			}
+		default:
+			current.WriteByte(key[i])
+			i++
+			pending = true
+		}
+	}
+	if pending {
+		segments = append(segments, current.String())
+	}
+	return segments
+}
+
+// NormalizeKey rewrites a key path, which may use escapes and bracket syntax,
+// in the canonical escaped form used by flattened data.
+func NormalizeKey(key, delim string) string {
+	if !strings.ContainsAny(key, `\[`) {
+		return key
+	}
+	return JoinSegments(SplitKey(key, delim), delim)
+}
+
+// parseBracket parses a bracketed segment at the start of s, such as ["a.b"],
+// ['a.b'] or [0], returning the segment and the number of bytes consumed.
+func parseBracket(s string) (string, int, bool) {
+	if len(s) < 3 {
+		return "", 0, false
+	}
+	switch quote := s[1]; quote {
+	case '"', '\'':
+		for i := 2; i < len(s); i++ {
+			if s[i] == '\\' && quote == '"' {
+				i++
+				continue
+			}
+			if s[i] != quote {
+				continue
+			}
+			if i+1 >= len(s) || s[i+1] != ']' {
+				return "", 0, false
+			}
+			if quote == '\'' {
+				return s[2:i], i + 2, true
+			}
+			segment, err := strconv.Unquote(s[1 : i+1])
+			if err != nil {
+				return "", 0, false
+			}
+			return segment, i + 2, true
+		}
+		return "", 0, false
+	default:
+		end := strings.IndexByte(s, ']')
+		if end <= 1 || strings.ContainsAny(s[1:end], `"'[`) {
+			return "", 0, false
+		}
+		return s[1:end], end + 1, true
+	}
+}
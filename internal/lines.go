@@ -0,0 +1,309 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// JSONKeyLines returns the line number on which each key path of a JSON document is defined.
+// Keys inside arrays are not reported.
+func JSONKeyLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	_ = walkJSON(dec, data, "", lines)
+	return lines
+}
+
+// walkJSON consumes one JSON value from dec, recording object key lines under path.
+// A nil lines map consumes the value without recording anything.
+func walkJSON(dec *json.Decoder, data []byte, path string, lines map[string]int) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := keyTok.(string)
+			keyPath := joinKey(path, escapeSegment(key))
+			if lines != nil {
+				lines[keyPath] = lineAt(data, dec.InputOffset())
+			}
+			if err := walkJSON(dec, data, keyPath, lines); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+		return err
+	case json.Delim('['):
+		for dec.More() {
+			if err := walkJSON(dec, data, path, nil); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+		return err
+	}
+	return nil
+}
+
+// TOMLKeyLines returns the line number on which each key path of a TOML document is defined.
+// Keys inside arrays of tables are reported under the index of their table, as
+// in servers.0.host, and the array itself on the line of its first table.
+func TOMLKeyLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+	table := ""
+	tables := newTOMLTables()
+	multiline := ""
+
+	scanLines(data, func(n int, line string) {
+		trimmed := strings.TrimSpace(line)
+		if multiline != "" {
+			if strings.Contains(trimmed, multiline) {
+				multiline = ""
+			}
+			return
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			return
+		}
+
+		if strings.HasPrefix(trimmed, "[") {
+			header := strings.Trim(stripComment(trimmed, "#"), "[] \t")
+			array := strings.HasPrefix(trimmed, "[[")
+			table = tables.name(joinSegments(splitTOMLKey(header)), array)
+			if array {
+				if _, ok := lines[tables.base(table)]; !ok {
+					lines[tables.base(table)] = n
+				}
+			}
+			lines[table] = n
+			return
+		}
+
+		eq := strings.Index(trimmed, "=")
+		if eq < 0 {
+			return
+		}
+		keyPath := joinKey(table, joinSegments(splitTOMLKey(trimmed[:eq])))
+		lines[keyPath] = n
+
+		value := strings.TrimSpace(trimmed[eq+1:])
+		for _, delim := range []string{`"""`, `'''`} {
+			if strings.HasPrefix(value, delim) && !strings.Contains(value[len(delim):], delim) {
+				multiline = delim
+			}
+		}
+	})
+	return lines
+}
+
+// INIKeyLines returns the line number on which each key path of an INI document is defined.
+func INIKeyLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+	section := ""
+
+	scanLines(data, func(n int, line string) {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "#") {
+			return
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			section = strings.TrimSpace(strings.Trim(trimmed, "[]"))
+			if strings.EqualFold(section, "DEFAULT") {
+				section = ""
+			}
+			return
+		}
+		sep := strings.IndexAny(trimmed, "=:")
+		if sep < 0 {
+			return
+		}
+		lines[INIKey(section, strings.TrimSpace(trimmed[:sep]))] = n
+	})
+	return lines
+}
+
+// YAMLKeyLines returns the line number on which each mapping key of a block-style
+// YAML document is defined. Keys inside sequences and flow collections are not reported.
+func YAMLKeyLines(data []byte) map[string]int {
+	type frame struct {
+		indent int
+		key    string
+	}
+
+	lines := make(map[string]int)
+	var stack []frame
+	// blockIndent is the indentation of a line whose more-indented continuation
+	// lines (block scalars and sequence items) are skipped.
+	blockIndent := -1
+
+	scanLines(data, func(n int, line string) {
+		trimmed := strings.TrimSpace(line)
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if blockIndent >= 0 {
+			if trimmed == "" || indent > blockIndent {
+				return
+			}
+			blockIndent = -1
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			return
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		if strings.HasPrefix(trimmed, "-") {
+			blockIndent = indent
+			return
+		}
+
+		colon := strings.Index(trimmed, ": ")
+		if colon < 0 {
+			if !strings.HasSuffix(trimmed, ":") {
+				return
+			}
+			colon = len(trimmed) - 1
+		}
+		key := strings.Trim(trimmed[:colon], `"'`)
+
+		segments := make([]string, 0, len(stack)+1)
+		for _, f := range stack {
+			segments = append(segments, f.key)
+		}
+		lines[joinSegments(append(segments, key))] = n
+		stack = append(stack, frame{indent: indent, key: key})
+
+		value := strings.TrimSpace(stripComment(trimmed[colon+1:], " #"))
+		if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+			blockIndent = indent
+		}
+	})
+	return lines
+}
+
+// RekeyLines converts lines, keyed by dot-separated key paths, to the keys of
+// data, whose segments are separated by delim. Only keys of data are kept.
+func RekeyLines(lines map[string]int, data map[string]interface{}, delim string) map[string]int {
+	if lines == nil || delim == "." {
+		return lines
+	}
+	rekeyed := make(map[string]int, len(data))
+	for k := range data {
+		if n, ok := lines[joinSegments(SplitKey(k, delim))]; ok {
+			rekeyed[k] = n
+		}
+	}
+	return rekeyed
+}
+
+// scanLines calls fn with each line of data and its 1-based line number.
+func scanLines(data []byte, fn func(n int, line string)) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for n := 1; scanner.Scan(); n++ {
+		fn(n, strings.TrimRight(scanner.Text(), "\r"))
+	}
+}
+
+// tomlTables names the tables of a TOML document, numbering the elements of
+// each array of tables so that [[servers]] is servers.0, then servers.1, and a
+// table nested in the second element, [servers.meta], is servers.1.meta.
+type tomlTables struct {
+	// current maps the header of each array of tables to its latest element.
+	current map[string]string
+	count   map[string]int
+}
+
+func newTOMLTables() *tomlTables {
+	return &tomlTables{current: make(map[string]string), count: make(map[string]int)}
+}
+
+// name returns the key path of the table with the given header, which is an
+// element of an array of tables if array is set.
+func (t *tomlTables) name(header string, array bool) string {
+	name, parent := header, ""
+	for h := range t.current {
+		if strings.HasPrefix(header, h+".") && len(h) > len(parent) {
+			parent = h
+		}
+	}
+	if parent != "" {
+		name = t.current[parent] + strings.TrimPrefix(header, parent)
+	}
+	if !array {
+		return name
+	}
+	element := name + "." + strconv.Itoa(t.count[name])
+	t.count[name]++
+	t.current[header] = element
+	return element
+}
+
+// base returns the array of tables an element name returned by name belongs to.
+func (t *tomlTables) base(element string) string {
+	return element[:strings.LastIndex(element, ".")]
+}
+
+// splitTOMLKey splits a possibly dotted and quoted TOML key into its segments.
+func splitTOMLKey(key string) []string {
+	var segments []string
+	var current strings.Builder
+	var quote rune
+	for _, r := range strings.TrimSpace(key) {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '.':
+			segments = append(segments, strings.TrimSpace(current.String()))
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	return append(segments, strings.TrimSpace(current.String()))
+}
+
+func stripComment(s, marker string) string {
+	if i := strings.Index(s, marker); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// joinSegments joins raw key segments into an escaped dotted key.
+func joinSegments(segments []string) string {
+	return JoinSegments(segments, DefaultDelimiter)
+}
+
+func escapeSegment(segment string) string {
+	return EscapeSegment(segment, DefaultDelimiter)
+}
+
+// joinKey appends the escaped key to the escaped prefix.
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
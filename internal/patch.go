@@ -0,0 +1,550 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LinePatch describes an in-place edit of a line-oriented document such as TOML or INI.
+type LinePatch struct {
+	// Original is the document to edit and Current its flattened content.
+	Original []byte
+	Current  map[string]interface{}
+	// Data is the flattened content the edited document must hold.
+	Data map[string]interface{}
+	// Render formats a value the way it is written after a key and its separator.
+	Render func(v interface{}) (string, error)
+}
+
+// lineEntry is a key assignment, which may span several lines.
+type lineEntry struct {
+	key         string
+	table       int
+	first, last int
+	// prefix is the text of the first line up to the value, and suffix the
+	// trailing comment of the last line, both kept when the value is replaced.
+	prefix, suffix string
+}
+
+// lineTable is a table or section of a document. The first table is the root,
+// which has no header line.
+type lineTable struct {
+	name    string
+	header  int
+	end     int
+	array   bool
+	entries int
+}
+
+type lineDoc struct {
+	lines   []string
+	entries []lineEntry
+	tables  []lineTable
+}
+
+// lineSyntax describes how patchLines reads and writes a particular format.
+type lineSyntax struct {
+	parse func(lines []string) *lineDoc
+	// split divides a new key that belongs to no existing table into the name
+	// of the table to create for it and the key within that table.
+	split  func(key string) (table, rest string)
+	assign func(key, value string) string
+	header func(table string) string
+}
+
+// PatchTOML rewrites a TOML document so that it holds p.Data, replacing only the
+// values that changed and keeping comments, key order and formatting. The
+// tables of an array of tables are named by index, as in servers.0, so p.Current
+// and p.Data must address their keys likewise. Inline tables whose content
+// changed and new elements of arrays of tables cannot be edited in place and
+// are reported as an error.
+func PatchTOML(p LinePatch) ([]byte, error) {
+	return patchLines(p, lineSyntax{
+		parse: parseTOMLLines,
+		split: func(key string) (string, string) {
+			segments := SplitKey(key, DefaultDelimiter)
+			return joinSegments(segments[:len(segments)-1]), escapeSegment(segments[len(segments)-1])
+		},
+		assign: func(key, value string) string { return tomlKey(key) + " = " + value },
+		header: func(table string) string { return "[" + tomlKey(table) + "]" },
+	})
+}
+
+// PatchINI rewrites an INI document so that it holds p.Data, replacing only the
+// values that changed and keeping comments, key order and formatting.
+func PatchINI(p LinePatch) ([]byte, error) {
+	return patchLines(p, lineSyntax{
+		parse: parseINILines,
+		split: func(key string) (string, string) {
+			segments := SplitKey(key, DefaultDelimiter)
+			if len(segments) == 1 {
+				return "", key
+			}
+			return escapeSegment(segments[0]), joinSegments(segments[1:])
+		},
+		assign: func(key, value string) string { return rawKey(key) + " = " + value },
+		header: func(table string) string { return "[" + rawKey(table) + "]" },
+	})
+}
+
+func patchLines(p LinePatch, syntax lineSyntax) ([]byte, error) {
+	text := string(p.Original)
+	newline := "\n"
+	if strings.Contains(text, "\r\n") {
+		newline = "\r\n"
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+	var lines []string
+	if text != "" {
+		lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+	doc := syntax.parse(lines)
+
+	replace := make(map[int]string)
+	drop := make(map[int]bool)
+	insert := make(map[int][]string)
+	handled := make(map[string]bool)
+	kept := make([]int, len(doc.tables))
+
+	dropEntry := func(e lineEntry) {
+		for i := e.first; i <= e.last; i++ {
+			drop[i] = true
+		}
+	}
+
+	for _, e := range doc.entries {
+		old, isLeaf := p.Current[e.key]
+		want, wanted := p.Data[e.key]
+		switch {
+		case isLeaf && !wanted:
+			dropEntry(e)
+		case isLeaf:
+			handled[e.key] = true
+			kept[e.table]++
+			if sameValue(p.Render, old, want) {
+				continue
+			}
+			value, err := p.Render(want)
+			if err != nil {
+				return nil, fmt.Errorf("cannot patch %s in place: %w", e.key, err)
+			}
+			dropEntry(e)
+			delete(drop, e.first)
+			replace[e.first] = e.prefix + value + e.suffix
+		case hasPrefix(p.Current, e.key):
+			// An inline table is kept as written while its content is unchanged.
+			if !hasPrefix(p.Data, e.key) {
+				dropEntry(e)
+				continue
+			}
+			if !samePrefix(p, e.key) {
+				return nil, fmt.Errorf("cannot patch inline table %s in place", e.key)
+			}
+			for k := range p.Data {
+				if strings.HasPrefix(k, e.key+".") {
+					handled[k] = true
+				}
+			}
+			kept[e.table]++
+		default:
+			// Assignments the flattened content cannot address, such as keys
+			// inside arrays of tables, are left untouched.
+			kept[e.table]++
+		}
+	}
+
+	for _, t := range doc.tables {
+		if !t.array || handled[t.name] {
+			continue
+		}
+		if old, ok := p.Current[t.name]; ok {
+			if want, wanted := p.Data[t.name]; !wanted || !sameValue(p.Render, old, want) {
+				return nil, fmt.Errorf("cannot patch array of tables %s in place", t.name)
+			}
+			handled[t.name] = true
+		}
+	}
+
+	var added []string
+	for k, want := range p.Data {
+		if handled[k] {
+			continue
+		}
+		if old, ok := p.Current[k]; ok {
+			if !sameValue(p.Render, old, want) {
+				return nil, fmt.Errorf("cannot patch %s in place", k)
+			}
+			continue
+		}
+		added = append(added, k)
+	}
+	sort.Strings(added)
+
+	newTables := make(map[string][]string)
+	for _, k := range added {
+		value, err := p.Render(p.Data[k])
+		if err != nil {
+			return nil, fmt.Errorf("cannot patch %s in place: %w", k, err)
+		}
+		t := doc.tableFor(k)
+		if array := doc.arrayFor(k); array != "" && !strings.HasPrefix(doc.tables[t].name, array+".") {
+			return nil, fmt.Errorf("cannot add %s to array of tables %s in place", k, array)
+		}
+		if doc.tables[t].name == "" {
+			if table, rest := syntax.split(k); table != "" {
+				newTables[table] = append(newTables[table], syntax.assign(rest, value))
+				continue
+			}
+		}
+		rest := k
+		if name := doc.tables[t].name; name != "" {
+			rest = strings.TrimPrefix(k, name+".")
+		}
+		pos := doc.insertAt(t)
+		insert[pos] = append(insert[pos], syntax.assign(rest, value))
+		kept[t]++
+	}
+
+	// Drop the headers of tables whose every assignment was removed, along with
+	// the blank line separating them from the previous table.
+	for i, t := range doc.tables {
+		if t.header < 0 || t.entries == 0 || kept[i] > 0 || hasPrefix(p.Data, t.name) {
+			continue
+		}
+		drop[t.header] = true
+		if t.header > 0 && strings.TrimSpace(lines[t.header-1]) == "" {
+			drop[t.header-1] = true
+		}
+	}
+
+	// Keys added to a root table without assignments go above the first
+	// header, separated from it by a blank line.
+	if root := doc.insertAt(0); len(insert[root]) > 0 && doc.tables[0].end < 0 && root < len(lines) {
+		insert[root] = append(insert[root], "")
+	}
+
+	var out []string
+	for i := 0; i <= len(lines); i++ {
+		out = append(out, insert[i]...)
+		if i == len(lines) {
+			break
+		}
+		if r, ok := replace[i]; ok {
+			out = append(out, r)
+		} else if !drop[i] {
+			out = append(out, lines[i])
+		}
+	}
+
+	names := make([]string, 0, len(newTables))
+	for name := range newTables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if len(out) > 0 && strings.TrimSpace(out[len(out)-1]) != "" {
+			out = append(out, "")
+		}
+		out = append(out, syntax.header(name))
+		out = append(out, newTables[name]...)
+	}
+
+	if len(out) == 0 {
+		return []byte{}, nil
+	}
+	return []byte(strings.Join(out, newline) + newline), nil
+}
+
+// tableFor returns the index of the table a new key belongs to: the last
+// defined table with the longest name that prefixes key.
+func (d *lineDoc) tableFor(key string) int {
+	best := 0
+	for i, t := range d.tables {
+		if t.name != "" && !strings.HasPrefix(key, t.name+".") {
+			continue
+		}
+		if len(t.name) >= len(d.tables[best].name) {
+			best = i
+		}
+	}
+	return best
+}
+
+// arrayFor returns the innermost array of tables that key belongs to, if any.
+func (d *lineDoc) arrayFor(key string) string {
+	best := ""
+	for _, t := range d.tables {
+		if !t.array {
+			continue
+		}
+		if array := t.name[:strings.LastIndex(t.name, ".")]; strings.HasPrefix(key, array+".") && len(array) > len(best) {
+			best = array
+		}
+	}
+	return best
+}
+
+// insertAt returns the line before which new assignments of table t are inserted.
+func (d *lineDoc) insertAt(t int) int {
+	if end := d.tables[t].end; end >= 0 {
+		return end + 1
+	}
+	// The root table has no assignments: insert above the comments that
+	// introduce the first header.
+	if len(d.tables) == 1 {
+		return len(d.lines)
+	}
+	pos := d.tables[1].header
+	for pos > 0 && isCommentLine(d.lines[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+func parseTOMLLines(lines []string) *lineDoc {
+	doc := &lineDoc{lines: lines, tables: []lineTable{{header: -1, end: -1}}}
+	tables := newTOMLTables()
+	current := 0
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			header := strings.Trim(strings.TrimSpace(trimmed[:commentIndex(trimmed, "#")]), "[] \t")
+			array := strings.HasPrefix(trimmed, "[[")
+			doc.tables = append(doc.tables, lineTable{
+				name:   tables.name(joinSegments(splitTOMLKey(header)), array),
+				header: i,
+				end:    i,
+				array:  array,
+			})
+			current = len(doc.tables) - 1
+			continue
+		}
+
+		eq := strings.Index(lines[i], "=")
+		if eq < 0 {
+			continue
+		}
+		e := lineEntry{
+			key:    joinKey(doc.tables[current].name, joinSegments(splitTOMLKey(lines[i][:eq]))),
+			table:  current,
+			first:  i,
+			last:   tomlValueEnd(lines, i, eq+1),
+			prefix: lines[i][:eq+1] + leadingSpace(lines[i][eq+1:]),
+		}
+		if !strings.HasPrefix(strings.TrimSpace(lines[i][eq+1:]), `"""`) && !strings.HasPrefix(strings.TrimSpace(lines[i][eq+1:]), `'''`) {
+			last := lines[e.last]
+			e.suffix = trailingComment(last, commentIndex(last, "#"))
+		}
+		doc.entries = append(doc.entries, e)
+		doc.tables[current].end = e.last
+		doc.tables[current].entries++
+		i = e.last
+	}
+	return doc
+}
+
+func parseINILines(lines []string) *lineDoc {
+	doc := &lineDoc{lines: lines, tables: []lineTable{{header: -1, end: -1}}}
+	current := 0
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || isCommentLine(line) {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			section := strings.TrimSpace(strings.Trim(trimmed, "[]"))
+			if strings.EqualFold(section, "DEFAULT") {
+				section = ""
+			}
+			doc.tables = append(doc.tables, lineTable{name: PropertyKey(section), header: i, end: i})
+			current = len(doc.tables) - 1
+			continue
+		}
+
+		sep := strings.IndexAny(line, "=:")
+		if sep < 0 {
+			continue
+		}
+		doc.entries = append(doc.entries, lineEntry{
+			key:    joinKey(doc.tables[current].name, PropertyKey(strings.TrimSpace(line[:sep]))),
+			table:  current,
+			first:  i,
+			last:   i,
+			prefix: line[:sep+1] + leadingSpace(line[sep+1:]),
+			suffix: trailingComment(line, iniCommentIndex(line, sep+1)),
+		})
+		doc.tables[current].end = i
+		doc.tables[current].entries++
+	}
+	return doc
+}
+
+// tomlValueEnd returns the index of the line on which the value starting at
+// lines[first][col:] ends, following multi-line strings and arrays.
+func tomlValueEnd(lines []string, first, col int) int {
+	value := strings.TrimSpace(lines[first][col:])
+	for _, delim := range []string{`"""`, `'''`} {
+		if strings.HasPrefix(value, delim) && !strings.Contains(value[len(delim):], delim) {
+			for i := first + 1; i < len(lines); i++ {
+				if strings.Contains(lines[i], delim) {
+					return i
+				}
+			}
+			return len(lines) - 1
+		}
+	}
+
+	depth := 0
+	text := lines[first][col:]
+	for i := first; i < len(lines); i++ {
+		if i > first {
+			text = lines[i]
+		}
+		depth += bracketDepth(text)
+		if depth <= 0 {
+			return i
+		}
+	}
+	return len(lines) - 1
+}
+
+// bracketDepth returns how many brackets and braces s opens, ignoring strings and comments.
+func bracketDepth(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return depth
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+// commentIndex returns the index at which a marker comment starts in s outside
+// of quoted strings, or len(s) if there is none.
+func commentIndex(s, marker string) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.HasPrefix(s[i:], marker):
+			return i
+		}
+	}
+	return len(s)
+}
+
+// iniCommentIndex returns the index of an inline INI comment, a ; or # preceded
+// by whitespace, in the value starting at from, or len(s) if there is none.
+func iniCommentIndex(s string, from int) int {
+	for i := from + 1; i < len(s); i++ {
+		if (s[i] == ';' || s[i] == '#') && (s[i-1] == ' ' || s[i-1] == '\t') {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// trailingComment returns the comment of s starting at i together with the whitespace before it.
+func trailingComment(s string, i int) string {
+	if i >= len(s) {
+		return ""
+	}
+	return s[len(strings.TrimRight(s[:i], " \t")):]
+}
+
+func leadingSpace(s string) string {
+	return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+}
+
+func isCommentLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";")
+}
+
+var bareTOMLKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlKey writes an escaped key as a dotted TOML key, quoting the segments that are not valid bare keys.
+func tomlKey(key string) string {
+	segments := SplitKey(key, DefaultDelimiter)
+	for i, s := range segments {
+		if !bareTOMLKey.MatchString(s) {
+			segments[i] = strconv.Quote(s)
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+// rawKey writes an escaped key as a plain dotted name, as INI keys are written.
+func rawKey(key string) string {
+	return strings.Join(SplitKey(key, DefaultDelimiter), ".")
+}
+
+// sameValue reports whether a and b are written identically.
+func sameValue(render func(interface{}) (string, error), a, b interface{}) bool {
+	ra, errA := render(a)
+	rb, errB := render(b)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return ra == rb
+}
+
+// samePrefix reports whether p.Current and p.Data hold the same keys below prefix, with the same values.
+func samePrefix(p LinePatch, prefix string) bool {
+	count := 0
+	for k, old := range p.Current {
+		if !strings.HasPrefix(k, prefix+".") {
+			continue
+		}
+		count++
+		want, ok := p.Data[k]
+		if !ok || !sameValue(p.Render, old, want) {
+			return false
+		}
+	}
+	for k := range p.Data {
+		if strings.HasPrefix(k, prefix+".") {
+			count--
+		}
+	}
+	return count == 0
+}
+
+func hasPrefix(m map[string]interface{}, prefix string) bool {
+	for k := range m {
+		if strings.HasPrefix(k, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
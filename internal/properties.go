@@ -0,0 +1,272 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Property is a key and value assigned in a Java properties document.
+type Property struct {
+	Key   string
+	Value string
+	// Line is the 1-based line on which the assignment starts.
+	Line int
+}
+
+// propertyEntry is an assignment together with the lines it spans and the
+// text of its first line up to the value, kept when the value is replaced.
+type propertyEntry struct {
+	Property
+	first, last int
+	prefix      string
+}
+
+// ParseProperties parses a document in the format of java.util.Properties. A
+// line ending in an odd number of backslashes continues on the next line, lines
+// starting with # or ! are comments, and the key ends at the first unescaped =,
+// : or whitespace. Keys and values may contain the escapes \t, \n, \r, \f and
+// \uXXXX; a backslash before any other character stands for that character.
+func ParseProperties(data []byte) ([]Property, error) {
+	entries, err := parseProperties(documentLines(data))
+	props := make([]Property, len(entries))
+	for i, e := range entries {
+		props[i] = e.Property
+	}
+	return props, err
+}
+
+// PropertyKey returns the escaped dotted key of a property, whose name is split into segments on its dots.
+func PropertyKey(name string) string {
+	if name == "" {
+		return ""
+	}
+	return joinSegments(strings.Split(name, "."))
+}
+
+// INIKey returns the escaped key of an INI key name within a section. Section
+// and key names are dotted paths, as property names are, so port in the section
+// server.http is the key server.http.port. The default section is named "".
+func INIKey(section, name string) string {
+	return joinKey(PropertyKey(section), PropertyKey(name))
+}
+
+// EscapeProperty escapes s as a property key or value the way
+// java.util.Properties stores it. Separators, comment characters and, in a key
+// or at the start of a value, spaces are escaped with a backslash, and
+// characters outside printable ASCII are written as \uXXXX.
+func EscapeProperty(s string, key bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch r {
+		case ' ':
+			if key || i == 0 {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(' ')
+		case '\\':
+			b.WriteString(`\\`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '=', ':', '#', '!':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		default:
+			if r < 0x20 || r > 0x7e {
+				for _, u := range utf16.Encode([]rune{r}) {
+					fmt.Fprintf(&b, `\u%04X`, u)
+				}
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// PropertiesKeyLines returns the line number on which each key of a properties
+// document is defined. If a key is assigned more than once, its last assignment is reported.
+func PropertiesKeyLines(data []byte) map[string]int {
+	props, _ := ParseProperties(data)
+	lines := make(map[string]int)
+	for _, p := range props {
+		if key := PropertyKey(p.Key); key != "" {
+			lines[key] = p.Line
+		}
+	}
+	return lines
+}
+
+// PatchProperties rewrites a properties document so that it holds p.Data,
+// replacing only the values that changed and keeping comments, order and
+// separators. New properties are appended at the end of the document.
+func PatchProperties(p LinePatch) ([]byte, error) {
+	return patchLines(p, lineSyntax{
+		parse:  parsePropertiesLines,
+		split:  func(key string) (string, string) { return "", key },
+		assign: func(key, value string) string { return EscapeProperty(rawKey(key), true) + "=" + value },
+	})
+}
+
+func parsePropertiesLines(lines []string) *lineDoc {
+	doc := &lineDoc{lines: lines, tables: []lineTable{{header: -1, end: -1}}}
+	// Assignments are kept up to the first one that cannot be parsed.
+	entries, _ := parseProperties(lines)
+	for _, e := range entries {
+		key := PropertyKey(e.Key)
+		if key == "" {
+			continue
+		}
+		doc.entries = append(doc.entries, lineEntry{key: key, first: e.first, last: e.last, prefix: e.prefix})
+		doc.tables[0].end = e.last
+		doc.tables[0].entries++
+	}
+	return doc
+}
+
+// documentLines splits data into lines without their line terminators.
+func documentLines(data []byte) []string {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+func parseProperties(lines []string) ([]propertyEntry, error) {
+	var entries []propertyEntry
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		e := propertyEntry{first: i}
+		e.Line = i + 1
+		indent := len(lines[i]) - len(line)
+
+		// Join the natural lines of the logical line, dropping the leading
+		// whitespace of each continuation line.
+		logical := line
+		firstLen := -1
+		for continues(logical) {
+			logical = logical[:len(logical)-1]
+			if firstLen < 0 {
+				firstLen = len(logical)
+			}
+			if i+1 == len(lines) {
+				break
+			}
+			i++
+			logical += strings.TrimLeft(lines[i], " \t\f")
+		}
+		e.last = i
+
+		keyEnd := 0
+		for keyEnd < len(logical) && strings.IndexByte("=: \t\f", logical[keyEnd]) < 0 {
+			if logical[keyEnd] == '\\' {
+				keyEnd++
+			}
+			keyEnd++
+		}
+		keyEnd = min(keyEnd, len(logical))
+		valueStart := keyEnd
+		for valueStart < len(logical) && strings.IndexByte(" \t\f", logical[valueStart]) >= 0 {
+			valueStart++
+		}
+		if valueStart < len(logical) && (logical[valueStart] == '=' || logical[valueStart] == ':') {
+			valueStart++
+			for valueStart < len(logical) && strings.IndexByte(" \t\f", logical[valueStart]) >= 0 {
+				valueStart++
+			}
+		}
+
+		var err error
+		if e.Key, err = unescapeProperty(logical[:keyEnd]); err != nil {
+			return entries, fmt.Errorf("line %d: %w", e.Line, err)
+		}
+		if e.Value, err = unescapeProperty(logical[valueStart:]); err != nil {
+			return entries, fmt.Errorf("line %d: %w", e.Line, err)
+		}
+		if firstLen < 0 || valueStart <= firstLen {
+			e.prefix = lines[e.first][:indent+valueStart]
+		} else {
+			// The key spans several lines: write it anew.
+			e.prefix = EscapeProperty(e.Key, true) + "="
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// continues reports whether line ends in an odd number of backslashes.
+func continues(line string) bool {
+	n := len(line) - len(strings.TrimRight(line, `\`))
+	return n%2 == 1
+}
+
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			r, n, err := unicodeEscape(s[i-1:])
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(r)
+			i += n - 2
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// unicodeEscape decodes the \uXXXX escape at the start of s, combined with a
+// second escape that completes a surrogate pair, and returns the number of
+// bytes decoded.
+func unicodeEscape(s string) (rune, int, error) {
+	code := func(s string) (rune, bool) {
+		if len(s) < 6 || !strings.HasPrefix(s, `\u`) {
+			return 0, false
+		}
+		u, err := strconv.ParseUint(s[2:6], 16, 16)
+		return rune(u), err == nil
+	}
+	r, ok := code(s)
+	if !ok {
+		return 0, 0, fmt.Errorf("malformed \\uxxxx encoding in %q", s[:min(len(s), 6)])
+	}
+	if utf16.IsSurrogate(r) {
+		if low, ok := code(s[6:]); ok {
+			if pair := utf16.DecodeRune(r, low); pair != unicode.ReplacementChar {
+				return pair, 12, nil
+			}
+		}
+	}
+	return r, 6, nil
+}
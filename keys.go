@@ -0,0 +1,24 @@
+package configmanager
+
+import "github.com/1broseidon/configmanager/internal"
+
+// Keys name values by their path from the root of the configuration, with
+// segments separated by the delimiter ("." unless set with WithDelimiter).
+// A segment containing the delimiter is written either escaped with a
+// backslash or in brackets, so these keys are the same:
+//
+//	hosts.example\.com.port
+//	hosts["example.com"].port
+//
+// Every method accepting a key understands both forms; keys returned by the
+// manager, such as those of GetData, use the escaped form.
+
+// normalize returns the canonical escaped form of key.
+func (cm *ConfigManager) normalize(key string) string {
+	return internal.NormalizeKey(key, cm.delim)
+}
+
+// KeyConflictError reports keys that cannot be saved or read as a section
+// together, because one holds a value and another lies below it, as with a.b
+// and a.b.c. Its Paths field lists every colliding key.
+type KeyConflictError = internal.ConflictError
@@ -0,0 +1,269 @@
+package configmanager
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/1broseidon/configmanager/internal"
+)
+
+// Priority orders configuration layers. Values from a layer with a higher
+// priority override values from layers with a lower one; layers that share a
+// priority are applied in the order they were first registered.
+type Priority int
+
+// Standard layer priorities, from lowest to highest precedence.
+const (
+	PriorityDefaults Priority = 0
+	PriorityFile     Priority = 100
+	PriorityEnv      Priority = 200
+	PriorityFlags    Priority = 300
+	PriorityOverride Priority = 400
+)
+
+// Names of the layers managed by ConfigManager itself. File layers are named after the file they were loaded from.
+const (
+	LayerDefaults  = "defaults"
+	LayerEnv       = "env"
+	LayerFlags     = "flags"
+	LayerOverrides = "overrides"
+)
+
+// layer is a single named source of flattened configuration data.
+type layer struct {
+	name     string
+	priority Priority
+	seq      uint64
+	data     map[string]interface{}
+
+	// loader and filename are set for layers loaded from a file, and fromFS marks
+	// files read from an fs.FS rather than the operating system.
+	loader   ConfigLoader
+	filename string
+	fromFS   bool
+
+	// lines and envVars record per-key provenance where the source provides it.
+	lines   map[string]int
+	envVars map[string]string
+
+	// lists records the keys of arrays stored element by element with
+	// WithArrayIndexing, which are restored as arrays rather than maps.
+	lists map[string]bool
+}
+
+// SetLayer registers data as the named layer, replacing any previous layer with
+// that name. The data may be nested or already flattened. It is copied, so
+// changing it afterwards does not change the configuration.
+func (cm *ConfigManager) SetLayer(name string, priority Priority, data map[string]interface{}) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	f := cm.listFlattener()
+	return cm.setLayer(&layer{name: name, priority: priority, data: f.FlattenPaths(internal.CopyMap(data)), lists: f.Lists})
+}
+
+// AddLayer registers the data held by an already loaded ConfigLoader as the named layer.
+func (cm *ConfigManager) AddLayer(name string, priority Priority, loader ConfigLoader) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	data, lists, err := cm.loaderData(loader)
+	if err != nil {
+		return fmt.Errorf("failed to read layer %s: %w", name, err)
+	}
+	return cm.setLayer(&layer{
+		name:     name,
+		priority: priority,
+		data:     data,
+		lists:    lists,
+		loader:   loader,
+		lines:    cm.keyLines(loader, data),
+	})
+}
+
+// RemoveLayer removes the named layer.
+func (cm *ConfigManager) RemoveLayer(name string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	previous, ok := cm.layers[name]
+	if !ok {
+		return fmt.Errorf("layer %s does not exist", name)
+	}
+	delete(cm.layers, name)
+	if err := cm.rebuild(name); err != nil {
+		cm.layers[name] = previous
+		return err
+	}
+	return nil
+}
+
+// Layers returns the names of all registered layers, from lowest to highest precedence.
+func (cm *ConfigManager) Layers() []string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	ordered := cm.orderedLayers()
+	names := make([]string, len(ordered))
+	for i, l := range ordered {
+		names[i] = l.name
+	}
+	return names
+}
+
+// SetDefaults registers data as the lowest-precedence defaults layer.
+func (cm *ConfigManager) SetDefaults(data map[string]interface{}) error {
+	return cm.SetLayer(LayerDefaults, PriorityDefaults, data)
+}
+
+// LoadFlags registers every flag that was explicitly set on fs as the flags
+// layer. Flag names are used as keys, so a flag named "server.port" overrides
+// the server.port key.
+func (cm *ConfigManager) LoadFlags(fs *flag.FlagSet) error {
+	if !fs.Parsed() {
+		return fmt.Errorf("flag set %s has not been parsed", fs.Name())
+	}
+
+	data := make(map[string]interface{})
+	fs.Visit(func(f *flag.Flag) {
+		if getter, ok := f.Value.(flag.Getter); ok {
+			data[f.Name] = getter.Get()
+		} else {
+			data[f.Name] = f.Value.String()
+		}
+	})
+	return cm.SetLayer(LayerFlags, PriorityFlags, data)
+}
+
+// setLayer stores l, keeping the registration order of any layer it replaces,
+// and recomputes the merged view. If the result fails validation the previous
+// layer is restored. The caller must hold cm.mu.
+func (cm *ConfigManager) setLayer(l *layer) error {
+	previous, existed := cm.layers[l.name]
+	if existed {
+		l.seq = previous.seq
+	} else {
+		cm.seq++
+		l.seq = cm.seq
+	}
+
+	cm.layers[l.name] = l
+	if err := cm.rebuild(l.name); err != nil {
+		if existed {
+			cm.layers[l.name] = previous
+		} else {
+			delete(cm.layers, l.name)
+		}
+		cm.logger.Warn("rejected configuration", "source", l.name, "error", err)
+		return err
+	}
+	return nil
+}
+
+// tombstone is stored in a layer in place of a deleted key, hiding the values
+// of that key in lower layers from the merged snapshot.
+type tombstone struct{}
+
+// deleteKey removes key from l, the runtime overrides layer, leaving a tombstone
+// if a lower layer also supplies the key. The caller must hold cm.mu.
+func (cm *ConfigManager) deleteKey(l *layer, key string) {
+	delete(l.data, key)
+	for _, other := range cm.layers {
+		if other.name == l.name || other.priority > l.priority {
+			continue
+		}
+		if _, ok := other.data[key]; ok {
+			l.data[key] = tombstone{}
+			return
+		}
+	}
+}
+
+// overrides returns a copy of the runtime overrides layer, or a new empty one,
+// for the caller to modify and pass to setLayer. The caller must hold cm.mu.
+func (cm *ConfigManager) overrides() *layer {
+	l := &layer{name: LayerOverrides, priority: PriorityOverride, data: make(map[string]interface{}), lists: make(map[string]bool)}
+	if existing, ok := cm.layers[LayerOverrides]; ok {
+		for k, v := range existing.data {
+			l.data[k] = v
+		}
+		for k := range existing.lists {
+			l.lists[k] = true
+		}
+	}
+	return l
+}
+
+// orderedLayers returns the layers sorted from lowest to highest precedence. The caller must hold cm.mu.
+func (cm *ConfigManager) orderedLayers() []*layer {
+	ordered := make([]*layer, 0, len(cm.layers))
+	for _, l := range cm.layers {
+		ordered = append(ordered, l)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].priority != ordered[j].priority {
+			return ordered[i].priority < ordered[j].priority
+		}
+		return ordered[i].seq < ordered[j].seq
+	})
+	return ordered
+}
+
+// rebuild recomputes the merged snapshot, and the layer supplying each key, from
+// every layer. The candidate snapshot is validated before it replaces the current
+// one; on success subscribers are notified of the resulting changes,
+// attributed to the source layer. The caller must hold cm.mu.
+func (cm *ConfigManager) rebuild(source string) error {
+	merged, sources := cm.merge("")
+	if err := cm.validate(source, merged); err != nil {
+		return err
+	}
+
+	lists := make(map[string]bool)
+	for _, l := range cm.layers {
+		for k := range l.lists {
+			lists[k] = true
+		}
+	}
+
+	previous := cm.current()
+	cm.snap.Store(&snapshot{data: merged, sources: sources, lists: lists})
+	cm.publish(source, previous.data, merged)
+	return nil
+}
+
+// merge merges every layer but the one named exclude, returning the merged data
+// and the layer supplying each key. The caller must hold cm.mu.
+func (cm *ConfigManager) merge(exclude string) (map[string]interface{}, map[string]*layer) {
+	merged := make(map[string]interface{})
+	sources := make(map[string]*layer)
+	for _, l := range cm.orderedLayers() {
+		if l.name == exclude {
+			continue
+		}
+		for k, v := range l.data {
+			if _, deleted := v.(tombstone); deleted {
+				delete(merged, k)
+				delete(sources, k)
+				continue
+			}
+			merged[k] = v
+			sources[k] = l
+		}
+	}
+	return merged, sources
+}
+
+// keyLines returns the key line numbers reported by loader, if it can report
+// them, for the keys of data as flattened by loaderData.
+func (cm *ConfigManager) keyLines(loader ConfigLoader, data map[string]interface{}) map[string]int {
+	locator, ok := loader.(KeyLocator)
+	if !ok {
+		return nil
+	}
+	if loaderDelimiter(loader) == cm.delim {
+		return locator.KeyLines()
+	}
+	return internal.RekeyLines(locator.KeyLines(), data, cm.delim)
+}
@@ -0,0 +1,92 @@
+package configmanager
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// redacted replaces the values of secret keys in log output.
+const redacted = "[REDACTED]"
+
+// secretMarkers are the key fragments that mark a value as secret.
+var secretMarkers = []string{"password", "passwd", "secret", "token", "apikey", "api_key", "privatekey", "private_key", "credential"}
+
+// isSecretKey reports whether the last segment of key names a secret. Any
+// character other than a letter, digit, '_' or '-' is taken to separate segments.
+func isSecretKey(key string) bool {
+	if i := strings.LastIndexFunc(key, isSegmentSeparator); i >= 0 {
+		key = key[i+1:]
+	}
+	key = strings.ToLower(key)
+	for _, marker := range secretMarkers {
+		if strings.Contains(key, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSegmentSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-'
+}
+
+// configValue is the value of a configuration key as written to the log.
+type configValue struct {
+	key   string
+	value interface{}
+}
+
+// LogValue implements slog.LogValuer, hiding the value of secret keys, including
+// those nested in a map set as a whole.
+func (v configValue) LogValue() slog.Value {
+	return slog.AnyValue(redact(v.key, v.value))
+}
+
+// redact returns value, or a copy of it in which the values of the secret keys
+// nested in its maps and slices are replaced, if key names a secret or it holds one.
+func redact(key string, value interface{}) interface{} {
+	if isSecretKey(key) {
+		return redacted
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return value
+		}
+		m := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			k := iter.Key().String()
+			m[k] = redact(k, iter.Value().Interface())
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() != reflect.Interface && rv.Type().Elem().Kind() != reflect.Map {
+			return value
+		}
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = redact("", rv.Index(i).Interface())
+		}
+		return items
+	default:
+		return value
+	}
+}
+
+// valueAttr returns the log attribute for the value of key.
+func valueAttr(key string, value interface{}) slog.Attr {
+	return slog.Any("value", configValue{key: key, value: value})
+}
+
+// discardHandler is the slog.Handler of the default logger, which drops every record.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
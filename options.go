@@ -0,0 +1,95 @@
+package configmanager
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// Option configures a ConfigManager created by New.
+type Option func(*ConfigManager)
+
+// WithDelimiter sets the string separating the segments of flattened keys,
+// "." by default. Use it when keys themselves contain dots, such as host names.
+func WithDelimiter(delim string) Option {
+	return func(cm *ConfigManager) {
+		if delim != "" {
+			cm.delim = delim
+		}
+	}
+}
+
+// WithEnvPrefix sets the prefix of the environment variables read by LoadEnv
+// and LoadEnvVariables, so that with the prefix "MYAPP" the key database.host
+// is overridden by MYAPP_DATABASE_HOST.
+func WithEnvPrefix(prefix string) Option {
+	return func(cm *ConfigManager) {
+		cm.envPrefix = strings.TrimSuffix(strings.ToUpper(prefix), "_")
+	}
+}
+
+// WithStrictKeys rejects every layer that supplies a key not declared by the
+// defaults layer, reporting each such key as ErrUnknownKey.
+func WithStrictKeys() Option {
+	return func(cm *ConfigManager) {
+		cm.strict = true
+	}
+}
+
+// WithArrayIndexing flattens arrays into one key per element, so that a list
+// of servers yields servers.0.host, servers.1.host and so on, which may also
+// be written servers[0].host. Arrays of tables in TOML and sequences of
+// mappings in YAML can then be read, overridden and saved element by element.
+func WithArrayIndexing() Option {
+	return func(cm *ConfigManager) {
+		cm.indexArrays = true
+	}
+}
+
+// WithDefaults registers data as the defaults layer, as SetDefaults does.
+func WithDefaults(data map[string]interface{}) Option {
+	return func(cm *ConfigManager) {
+		cm.defaults = data
+	}
+}
+
+// WithDefaultFormat sets the format, given as a name, extension or MIME type,
+// used for files and streams whose format is neither named nor recognisable,
+// such as a file without an extension that is being created by SaveToFile.
+func WithDefaultFormat(format string) Option {
+	return func(cm *ConfigManager) {
+		cm.defaultFormat = format
+	}
+}
+
+// WithEditMode makes SaveToFile edit existing files in place; see SetEditMode.
+func WithEditMode() Option {
+	return func(cm *ConfigManager) {
+		cm.editMode = true
+	}
+}
+
+// WithEditFallback lets SaveToFile rewrite files that edit mode cannot edit in
+// place; see SetEditFallback.
+func WithEditFallback() Option {
+	return func(cm *ConfigManager) {
+		cm.editFallback = true
+	}
+}
+
+// WithBackups sets how many previous versions of a file SaveToFile keeps; see SetBackups.
+func WithBackups(n int) Option {
+	return func(cm *ConfigManager) {
+		cm.backups = max(n, 0)
+	}
+}
+
+// WithLogger sets the logger used to report loading, saving, environment
+// overrides and reloads. Values of keys that look like secrets, such as
+// "database.password" or "api_token", are redacted. By default nothing is logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(cm *ConfigManager) {
+		if logger != nil {
+			cm.logger = logger
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package configmanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// KeyLocator is implemented by loaders that can report the line on which each
+// flattened key was defined in the most recently loaded document.
+type KeyLocator interface {
+	KeyLines() map[string]int
+}
+
+// Origin describes the source that supplied the current value of a key.
+type Origin struct {
+	// Layer is the name of the layer the value came from.
+	Layer    string
+	Priority Priority
+	// File is the path the layer was loaded from, if any.
+	File string
+	// Line is the line within File on which the key was defined, or 0 if the format cannot report it.
+	Line int
+	// EnvVar is the environment variable that supplied the value, if any.
+	EnvVar string
+}
+
+// String returns a short human-readable description of the origin.
+func (o Origin) String() string {
+	switch {
+	case o.EnvVar != "":
+		return fmt.Sprintf("env %s", o.EnvVar)
+	case o.File != "" && o.Line > 0:
+		return fmt.Sprintf("%s:%d", o.File, o.Line)
+	case o.File != "":
+		return o.File
+	default:
+		return o.Layer
+	}
+}
+
+// origin builds the Origin of key within l.
+func (l *layer) origin(key string) Origin {
+	return Origin{
+		Layer:    l.name,
+		Priority: l.priority,
+		File:     l.filename,
+		Line:     l.lines[key],
+		EnvVar:   l.envVars[key],
+	}
+}
+
+// Origin reports which layer supplied the current value of key.
+func (cm *ConfigManager) Origin(key string) (Origin, bool) {
+	key = cm.normalize(key)
+	l, ok := cm.current().sources[key]
+	if !ok {
+		return Origin{}, false
+	}
+	return l.origin(key), true
+}
+
+// Explain returns a human-readable dump of every key, its current value, the
+// source it came from and any lower-precedence layers it shadows. The values of
+// keys that look like secrets are shown as [REDACTED], as in the log.
+func (cm *ConfigManager) Explain() string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	current := cm.current()
+	keys := make([]string, 0, len(current.data))
+	for k := range current.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	ordered := cm.orderedLayers()
+	var b strings.Builder
+	for _, key := range keys {
+		source := current.sources[key]
+		fmt.Fprintf(&b, "%s = %v\n\tfrom %s (layer %s)\n", key, redact(key, current.data[key]), source.origin(key), source.name)
+		for _, l := range ordered {
+			if l == source {
+				continue
+			}
+			v, ok := l.data[key]
+			if _, deleted := v.(tombstone); ok && !deleted {
+				fmt.Fprintf(&b, "\tshadows %v from %s (layer %s)\n", redact(key, v), l.origin(key), l.name)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package configmanager
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/1broseidon/configmanager/internal"
+)
+
+// snapshot is an immutable merged view of every layer. Readers load the current
+// snapshot without locking; writers build a new one under cm.mu and publish it
+// atomically, so a snapshot's maps must never be modified once published.
+type snapshot struct {
+	data    map[string]interface{}
+	sources map[string]*layer
+	// lists holds the keys of arrays recorded by any layer.
+	lists map[string]bool
+}
+
+var emptySnapshot = &snapshot{
+	data:    map[string]interface{}{},
+	sources: map[string]*layer{},
+	lists:   map[string]bool{},
+}
+
+// current returns the latest published snapshot.
+func (cm *ConfigManager) current() *snapshot {
+	if s := cm.snap.Load(); s != nil {
+		return s
+	}
+	return emptySnapshot
+}
+
+// lookup returns the leaf value stored at key or, failing that, the unflattened
+// section rooted at key, restored by f with the snapshot's arrays. It reports
+// false if neither exists.
+func (s *snapshot) lookup(key string, f internal.Flattener) (interface{}, bool, error) {
+	if value, ok := s.data[key]; ok {
+		return value, true, nil
+	}
+
+	prefix := key + f.Delim
+	section := make(map[string]interface{})
+	for k, v := range s.data {
+		if strings.HasPrefix(k, prefix) {
+			section[strings.TrimPrefix(k, prefix)] = v
+		}
+	}
+	if len(section) == 0 {
+		return nil, false, nil
+	}
+	f.Lists = internal.ListsUnder(s.lists, key, f.Delim)
+	value, err := f.UnflattenValue(section)
+	var conflict *internal.ConflictError
+	if errors.As(err, &conflict) {
+		for i, path := range conflict.Paths {
+			conflict.Paths[i] = prefix + path
+		}
+	}
+	return value, true, err
+}
+
+// keysUnder returns the sorted keys of data that equal prefix or lie below it.
+// An empty prefix matches every key.
+func keysUnder(data map[string]interface{}, prefix, delim string) []string {
+	var keys []string
+	for k := range data {
+		if prefix == "" || k == prefix || strings.HasPrefix(k, prefix+delim) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hasKey reports whether data holds key or any key below it.
+func hasKey(data map[string]interface{}, key, delim string) bool {
+	if _, ok := data[key]; ok {
+		return true
+	}
+	for k := range data {
+		if strings.HasPrefix(k, key+delim) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyData returns a copy of the snapshot's flattened data that the caller may
+// modify. Slices and maps held as values are copied too, since they are shared
+// with every reader of the snapshot.
+func (s *snapshot) copyData() map[string]interface{} {
+	return internal.CopyMap(s.data)
+}
@@ -0,0 +1,229 @@
+package configmanager_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/internal"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+// TestFlattenIndexArrays tests that indexed flattening is reversed by Unflatten.
+func TestFlattenIndexArrays(t *testing.T) {
+	f := internal.Flattener{Delim: ".", IndexArrays: true}
+	data := map[string]interface{}{
+		"servers": []interface{}{
+			map[string]interface{}{"host": "a", "ports": []interface{}{80, 443}},
+			map[string]interface{}{"host": "b", "ports": []interface{}{}},
+		},
+		"name": "app",
+	}
+
+	flat := f.Flatten(data)
+	expected := map[string]interface{}{
+		"servers.0.host":    "a",
+		"servers.0.ports.0": 80,
+		"servers.0.ports.1": 443,
+		"servers.1.host":    "b",
+		"servers.1.ports":   []interface{}{},
+		"name":              "app",
+	}
+	if !reflect.DeepEqual(flat, expected) {
+		t.Fatalf("Flatten = %v, expected %v", flat, expected)
+	}
+	if got, err := f.Unflatten(flat); err != nil || !reflect.DeepEqual(got, data) {
+		t.Errorf("Unflatten = %v (%v), expected %v", got, err, data)
+	}
+
+	// Without IndexArrays, slices remain single values.
+	if got := internal.Flatten(data); !reflect.DeepEqual(got["servers"], data["servers"]) {
+		t.Errorf("Flatten without indexing = %v", got)
+	}
+}
+
+// TestArrayIndexingNumericKeys tests that maps whose keys look like indices are not mistaken for arrays.
+func TestArrayIndexingNumericKeys(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "errors.yaml")
+	testutils.ResetConfigFile(filename, []byte("errors:\n  404: not found\n  500: boom\ntags:\n  - web\n"))
+
+	cm := configmanager.New(configmanager.WithArrayIndexing())
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	errs, err := cm.GetStringMap("errors")
+	if err != nil || !reflect.DeepEqual(errs, map[string]interface{}{"404": "not found", "500": "boom"}) {
+		t.Errorf("Expected errors to be a map, got %v (%v)", errs, err)
+	}
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error reading saved file: %v", err)
+	}
+	if expected := "errors:\n  \"404\": not found\n  \"500\": boom\ntags:\n- web\n"; string(content) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, content)
+	}
+
+	if err := cm.Set("ports", []interface{}{80, 443}); err != nil {
+		t.Fatalf("Error setting key: %v", err)
+	}
+	if ports, err := cm.GetStringSlice("ports"); err != nil || !reflect.DeepEqual(ports, []string{"80", "443"}) {
+		t.Errorf("Expected ports [80 443], got %v (%v)", ports, err)
+	}
+}
+
+// TestArrayIndexingYAML tests reading and updating a sequence of mappings.
+func TestArrayIndexingYAML(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "servers.yaml")
+	testutils.ResetConfigFile(filename, []byte("servers:\n  - host: a.example.com\n    port: 80\n  - host: b.example.com\n    port: 81\ntags:\n  - web\n  - edge\n"))
+
+	cm := configmanager.New(configmanager.WithArrayIndexing())
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	testutils.AssertConfig(t, map[string]interface{}{
+		"servers.0.host": "a.example.com",
+		"servers.0.port": 80,
+		"servers.1.host": "b.example.com",
+		"servers.1.port": 81,
+		"tags.0":         "web",
+		"tags.1":         "edge",
+	}, cm.GetData())
+
+	if host := cm.GetStringOr("servers[1].host", ""); host != "b.example.com" {
+		t.Errorf("Expected servers[1].host to be b.example.com, got %q", host)
+	}
+	if tags, err := cm.GetStringSlice("tags"); err != nil || !reflect.DeepEqual(tags, []string{"web", "edge"}) {
+		t.Errorf("Expected tags [web edge], got %v (%v)", tags, err)
+	}
+
+	if err := cm.UpdateKey("servers[0].host", "c.example.com"); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+
+	var servers []struct {
+		Host string
+		Port int
+	}
+	if err := cm.UnmarshalKey("servers", &servers); err != nil {
+		t.Fatalf("Error unmarshaling servers: %v", err)
+	}
+	if len(servers) != 2 || servers[0].Host != "c.example.com" || servers[1].Port != 81 {
+		t.Errorf("Unexpected servers %+v", servers)
+	}
+
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+	reloaded := configmanager.New()
+	if err := reloaded.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	var saved struct {
+		Servers []map[string]interface{}
+		Tags    []string
+	}
+	if err := reloaded.Unmarshal(&saved); err != nil {
+		t.Fatalf("Error unmarshaling saved config: %v", err)
+	}
+	if len(saved.Servers) != 2 || saved.Servers[0]["host"] != "c.example.com" || !reflect.DeepEqual(saved.Tags, []string{"web", "edge"}) {
+		t.Errorf("Unexpected saved config %+v", saved)
+	}
+}
+
+// TestArrayIndexingTOML tests that arrays of tables round-trip through save.
+func TestArrayIndexingTOML(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "servers.toml")
+	testutils.ResetConfigFile(filename, []byte("[[servers]]\nhost = \"a.example.com\"\nport = 80\n\n[[servers]]\nhost = \"b.example.com\"\nport = 81\n"))
+
+	cm := configmanager.New(configmanager.WithArrayIndexing())
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if err := cm.UpdateKey("servers.1.port", 8081); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error reading saved file: %v", err)
+	}
+	if strings.Count(string(content), "[[servers]]") != 2 {
+		t.Errorf("Expected two [[servers]] tables, got:\n%s", content)
+	}
+
+	reloaded := configmanager.New(configmanager.WithArrayIndexing())
+	if err := reloaded.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	testutils.AssertConfig(t, map[string]interface{}{
+		"servers.0.host": "a.example.com",
+		"servers.0.port": int64(80),
+		"servers.1.host": "b.example.com",
+		"servers.1.port": int64(8081),
+	}, reloaded.GetData())
+}
+
+// TestArrayIndexingEnv tests that array elements can be overridden from the environment.
+func TestArrayIndexingEnv(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "servers.json")
+	testutils.ResetConfigFile(filename, []byte(`{"servers": [{"host": "a.example.com"}, {"host": "b.example.com"}]}`))
+
+	cm := configmanager.New(configmanager.WithArrayIndexing())
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	t.Setenv("SERVERS_1_HOST", "env.example.com")
+	if err := cm.LoadEnvVariables(&configmanager.DynamicConfig{Data: cm.GetData()}); err != nil {
+		t.Fatalf("Error loading env variables: %v", err)
+	}
+	if host := cm.GetStringOr("servers.1.host", ""); host != "env.example.com" {
+		t.Errorf("Expected servers.1.host to be env.example.com, got %q", host)
+	}
+}
+
+// TestArrayIndexingEditMode tests that elements of arrays are edited in place.
+func TestArrayIndexingEditMode(t *testing.T) {
+	for name, tc := range map[string]struct{ original, expected string }{
+		"servers.yaml": {
+			original: "servers:\n  - host: a # primary\n    port: 80\n  - host: b\n    port: 81\n",
+			expected: "servers:\n  - host: a # primary\n    port: 80\n  - host: c\n    port: 81\n",
+		},
+		"servers.toml": {
+			original: "# Servers\n[[servers]]\nhost = \"a\" # primary\nport = 80\n\n[[servers]]\nhost = \"b\"\nport = 81\n",
+			expected: "# Servers\n[[servers]]\nhost = \"a\" # primary\nport = 80\n\n[[servers]]\nhost = \"c\"\nport = 81\n",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), name)
+			testutils.ResetConfigFile(filename, []byte(tc.original))
+
+			cm := configmanager.New(configmanager.WithArrayIndexing(), configmanager.WithEditMode())
+			if err := cm.LoadFromFile(filename); err != nil {
+				t.Fatalf("Error loading config: %v", err)
+			}
+			if err := cm.UpdateKey("servers.1.host", "c"); err != nil {
+				t.Fatalf("Error updating key: %v", err)
+			}
+			if err := cm.SaveToFile(filename); err != nil {
+				t.Fatalf("Error saving config: %v", err)
+			}
+
+			content, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatalf("Error reading saved file: %v", err)
+			}
+			if string(content) != tc.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tc.expected, content)
+			}
+		})
+	}
+}
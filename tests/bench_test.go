@@ -0,0 +1,84 @@
+package configmanager_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+func newBenchManager(b *testing.B) *configmanager.ConfigManager {
+	b.Helper()
+	filename := filepath.Join(b.TempDir(), "config.toml")
+	content := "[server]\nhost = \"localhost\"\nport = 8080\n\n[database]\n"
+	for i := 0; i < 100; i++ {
+		content += fmt.Sprintf("key%d = \"value%d\"\n", i, i)
+	}
+	testutils.ResetConfigFile(filename, []byte(content))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		b.Fatalf("Error loading config: %v", err)
+	}
+	return cm
+}
+
+// BenchmarkGetStringParallel measures read throughput with many concurrent readers and no writers.
+func BenchmarkGetStringParallel(b *testing.B) {
+	cm := newBenchManager(b)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := cm.GetString("server.host"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkGetStringParallelWithWriter measures read throughput while a writer updates a key every millisecond.
+func BenchmarkGetStringParallelWithWriter(b *testing.B) {
+	cm := newBenchManager(b)
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = cm.UpdateKey("server.port", i)
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := cm.GetInt("server.port"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.StopTimer()
+	cancel()
+	wg.Wait()
+}
+
+// BenchmarkGetData measures the cost of the defensive copy returned by GetData.
+func BenchmarkGetData(b *testing.B) {
+	cm := newBenchManager(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = cm.GetData()
+	}
+}
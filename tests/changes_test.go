@@ -0,0 +1,170 @@
+package configmanager_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+func loadChangeFixture(t *testing.T) (*configmanager.ConfigManager, string) {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "config.toml")
+	testutils.ResetConfigFile(filename, []byte("[database]\nhost = \"localhost\"\nport = 5432\n\n[server]\nport = 8080\n"))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	return cm, filename
+}
+
+func nextEvent(t *testing.T, events <-chan configmanager.ChangeEvent) configmanager.ChangeEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for change event")
+		return configmanager.ChangeEvent{}
+	}
+}
+
+// TestOnChangePrefix tests that subscribers only see changes under their prefix, in order.
+func TestOnChangePrefix(t *testing.T) {
+	cm, filename := loadChangeFixture(t)
+
+	events := make(chan configmanager.ChangeEvent, 10)
+	sub := cm.OnChange("database.*", func(ev configmanager.ChangeEvent) { events <- ev })
+	defer sub.Unsubscribe()
+
+	if err := cm.UpdateKey("server.port", int64(9090)); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	if err := cm.UpdateKey("database.host", "db1"); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	if err := cm.UpdateKeys(map[string]interface{}{"database.host": "db2"}); err != nil {
+		t.Fatalf("Error updating keys: %v", err)
+	}
+
+	ev := nextEvent(t, events)
+	expected := []configmanager.Change{{Key: "database.host", Type: configmanager.ChangeModified, Old: "localhost", New: "db1"}}
+	if ev.Source != configmanager.LayerOverrides || !reflect.DeepEqual(ev.Changes, expected) {
+		t.Errorf("Unexpected first event: %+v", ev)
+	}
+	if ev := nextEvent(t, events); ev.Changes[0].Old != "db1" || ev.Changes[0].New != "db2" {
+		t.Errorf("Unexpected second event: %+v", ev)
+	}
+
+	// A reload that adds and removes keys is reported as a single change set.
+	testutils.ResetConfigFile(filename, []byte("[database]\nhost = \"localhost\"\nuser = \"admin\"\n\n[server]\nport = 8080\n"))
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	ev = nextEvent(t, events)
+	expected = []configmanager.Change{
+		{Key: "database.port", Type: configmanager.ChangeRemoved, Old: int64(5432)},
+		{Key: "database.user", Type: configmanager.ChangeAdded, New: "admin"},
+	}
+	if ev.Source != filename || !reflect.DeepEqual(ev.Changes, expected) {
+		t.Errorf("Unexpected reload event: %+v", ev)
+	}
+}
+
+// TestOnChangeNonBlocking tests that a slow subscriber does not block writers.
+func TestOnChangeNonBlocking(t *testing.T) {
+	cm, _ := loadChangeFixture(t)
+
+	release := make(chan struct{})
+	received := make(chan interface{}, 10)
+	sub := cm.OnChange("server.port", func(ev configmanager.ChangeEvent) {
+		<-release
+		received <- ev.Changes[0].New
+	})
+	defer sub.Unsubscribe()
+
+	done := make(chan struct{})
+	go func() {
+		for _, port := range []int{1, 2, 3} {
+			_ = cm.UpdateKey("server.port", port)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("UpdateKey blocked on a slow subscriber")
+	}
+
+	close(release)
+	for _, want := range []int{1, 2, 3} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("Expected value %d, got %v", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for event %d", want)
+		}
+	}
+}
+
+// TestOnChangeUnsubscribe tests that no events are delivered after Unsubscribe.
+func TestOnChangeUnsubscribe(t *testing.T) {
+	cm, _ := loadChangeFixture(t)
+
+	events := make(chan configmanager.ChangeEvent, 10)
+	sub := cm.OnChange("", func(ev configmanager.ChangeEvent) { events <- ev })
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+
+	if err := cm.UpdateKey("server.port", 1); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("Unexpected event after Unsubscribe: %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestOnChangeValuesAreCopies tests that a subscriber modifying the values of a
+// change affects neither the configuration nor other subscribers.
+func TestOnChangeValuesAreCopies(t *testing.T) {
+	cm := configmanager.New()
+	if err := cm.SetDefaults(map[string]interface{}{"server.tags": []interface{}{"a", "b"}}); err != nil {
+		t.Fatalf("Error setting defaults: %v", err)
+	}
+
+	mutated := make(chan configmanager.ChangeEvent, 1)
+	sub := cm.OnChange("", func(ev configmanager.ChangeEvent) {
+		ev.Changes[0].Old.([]interface{})[0] = "mutated"
+		ev.Changes[0].New.([]interface{})[0] = "mutated"
+		mutated <- ev
+	})
+	defer sub.Unsubscribe()
+	events := make(chan configmanager.ChangeEvent, 1)
+	other := cm.OnChange("server", func(ev configmanager.ChangeEvent) { events <- ev })
+	defer other.Unsubscribe()
+
+	if err := cm.Set("server.tags", []interface{}{"c", "d"}); err != nil {
+		t.Fatalf("Error setting key: %v", err)
+	}
+	nextEvent(t, mutated)
+	ev := nextEvent(t, events)
+
+	expected := []configmanager.Change{{
+		Key:  "server.tags",
+		Type: configmanager.ChangeModified,
+		Old:  []interface{}{"a", "b"},
+		New:  []interface{}{"c", "d"},
+	}}
+	if !reflect.DeepEqual(ev.Changes, expected) {
+		t.Errorf("Unexpected event for the second subscriber: %+v", ev)
+	}
+	testutils.AssertConfig(t, map[string]interface{}{"server.tags": []interface{}{"c", "d"}}, cm.GetData())
+}
@@ -1,8 +1,10 @@
 package configmanager_test
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/1broseidon/configmanager"
@@ -12,19 +14,29 @@ import (
 
 func TestUpdateKeysError(t *testing.T) {
 	cm := configmanager.New()
+	if err := cm.SetDefaults(map[string]interface{}{"existing.key": "old"}); err != nil {
+		t.Fatalf("Error setting defaults: %v", err)
+	}
 	updates := map[string]interface{}{
-		"nonexistent.key1": "value1",
 		"nonexistent.key2": "value2",
+		"existing.key":     "new",
+		"nonexistent.key1": "value1",
 	}
 	err := cm.UpdateKeys(updates)
 	if err == nil {
 		t.Fatalf("Expected error for updating non-existent keys, got nil")
 	}
 
-	expectedErr := "key nonexistent.key1 does not exist"
+	expectedErr := "keys nonexistent.key1, nonexistent.key2 do not exist"
 	if err.Error() != expectedErr {
 		t.Fatalf("Expected error `%s`, got `%s`", expectedErr, err.Error())
 	}
+	if !errors.Is(err, configmanager.ErrKeyNotFound) {
+		t.Errorf("Expected the error to match ErrKeyNotFound")
+	}
+	if value := cm.GetStringOr("existing.key", ""); value != "old" {
+		t.Errorf("Expected a failed batch to change nothing, got existing.key = %q", value)
+	}
 }
 
 func TestVariadicLoadFromFile(t *testing.T) {
@@ -126,3 +138,129 @@ port = 8080
 	}
 	testutils.AssertConfig(t, expected, newCm.GetData())
 }
+
+func TestGetDataReturnsCopy(t *testing.T) {
+	cm := configmanager.New()
+	if err := cm.SetDefaults(map[string]interface{}{
+		"server.port": 8080,
+		"server.tags": []interface{}{"a", "b"},
+		"server.ids":  []string{"x"},
+	}); err != nil {
+		t.Fatalf("Error setting defaults: %v", err)
+	}
+
+	data := cm.GetData()
+	data["server.port"] = 1
+	data["server.host"] = "mutated"
+	data["server.tags"].([]interface{})[0] = "mutated"
+	data["server.ids"].([]string)[0] = "mutated"
+	cm.Sub("server").GetData()["tags"].([]interface{})[1] = "mutated"
+
+	expected := map[string]interface{}{
+		"server.port": 8080,
+		"server.tags": []interface{}{"a", "b"},
+		"server.ids":  []string{"x"},
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+	if _, ok := cm.GetData()["server.host"]; ok {
+		t.Errorf("Mutating GetData result leaked into the configuration")
+	}
+}
+
+// TestUnmarshalReturnsCopy tests that changing what Unmarshal decodes into an
+// interface does not change the configuration.
+func TestUnmarshalReturnsCopy(t *testing.T) {
+	cm := configmanager.New()
+	if err := cm.SetDefaults(map[string]interface{}{
+		"server.tags":    []interface{}{"a", "b"},
+		"server.limits":  map[string]interface{}{"cpu": 2},
+		"server.enabled": true,
+	}); err != nil {
+		t.Fatalf("Error setting defaults: %v", err)
+	}
+
+	var out map[string]interface{}
+	if err := cm.Unmarshal(&out); err != nil {
+		t.Fatalf("Error unmarshalling: %v", err)
+	}
+	server := out["server"].(map[string]interface{})
+	server["tags"].([]interface{})[0] = "mutated"
+	server["limits"].(map[string]interface{})["cpu"] = 99
+
+	var section interface{}
+	if err := cm.UnmarshalKey("server.tags", &section); err != nil {
+		t.Fatalf("Error unmarshalling key: %v", err)
+	}
+	section.([]interface{})[1] = "mutated"
+
+	expected := map[string]interface{}{
+		"server.tags":       []interface{}{"a", "b"},
+		"server.limits.cpu": 2,
+		"server.enabled":    true,
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+}
+
+// TestSetCopiesValues tests that changing a value after passing it to Set,
+// UpdateKey or SetLayer does not change the configuration.
+func TestSetCopiesValues(t *testing.T) {
+	cm := configmanager.New()
+	defaults := map[string]interface{}{"server.ids": []interface{}{1, 2}}
+	if err := cm.SetDefaults(defaults); err != nil {
+		t.Fatalf("Error setting defaults: %v", err)
+	}
+	defaults["server.ids"].([]interface{})[0] = 99
+
+	tags := []interface{}{"a", "b"}
+	if err := cm.Set("server.tags", tags); err != nil {
+		t.Fatalf("Error setting key: %v", err)
+	}
+	tags[0] = "mutated"
+
+	hosts := []string{"h1"}
+	if err := cm.UpdateKey("server.ids", hosts); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	hosts[0] = "mutated"
+
+	var fromTx interface{}
+	if err := cm.Transaction(func(tx *configmanager.Tx) error {
+		var err error
+		fromTx, err = tx.Get("server.tags")
+		return err
+	}); err != nil {
+		t.Fatalf("Error running transaction: %v", err)
+	}
+	fromTx.([]interface{})[1] = "mutated"
+
+	expected := map[string]interface{}{
+		"server.tags": []interface{}{"a", "b"},
+		"server.ids":  []string{"h1"},
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+}
+
+func TestConcurrentReadsAndWrites(t *testing.T) {
+	cm := configmanager.New()
+	if err := cm.SetDefaults(map[string]interface{}{"server.port": 0}); err != nil {
+		t.Fatalf("Error setting defaults: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				_ = cm.GetIntOr("server.port", -1)
+				_ = cm.GetData()
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		if err := cm.UpdateKey("server.port", i); err != nil {
+			t.Fatalf("Error updating key: %v", err)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,107 @@
+package configmanager_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/formats"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+var detectSamples = map[string]string{
+	"json":       `{"database": {"host": "localhost", "port": 5432}}`,
+	"yaml":       "# database settings\ndatabase:\n  host: localhost\n  port: 5432\n",
+	"toml":       "# database settings\n[database]\nhost = \"localhost\"\nport = 5432\n",
+	"ini":        "; database settings\n[database]\nhost = localhost\nport = 5432\n",
+	"dotenv":     "# database settings\nDATABASE_HOST=localhost\nDATABASE_PORT=5432\n",
+	"properties": "! database settings\ndatabase.host=localhost\ndatabase.port: 5432\n",
+	"hcl":        "# database settings\ndatabase {\n  host = \"localhost\"\n  port = 5432\n}\n",
+}
+
+// TestDetectFormat tests the content heuristics for each built-in format.
+func TestDetectFormat(t *testing.T) {
+	for name, content := range detectSamples {
+		f, confidence := configmanager.DetectFormat([]byte(content))
+		if f == nil || f.Name() != name {
+			t.Errorf("Expected %s to be detected, got %v (%.2f)", name, f, confidence)
+			continue
+		}
+		if confidence < formats.MinDetectConfidence || confidence > 1 {
+			t.Errorf("Unexpected confidence %.2f for %s", confidence, name)
+		}
+	}
+
+	if f, confidence := configmanager.DetectFormat([]byte("just some text")); f != nil && confidence >= formats.MinDetectConfidence {
+		t.Errorf("Expected plain text not to be detected, got %s (%.2f)", f.Name(), confidence)
+	}
+}
+
+// TestLoadWithoutExtension tests that files with a missing or unknown extension are loaded by sniffing.
+func TestLoadWithoutExtension(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range detectSamples {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(dir, name+"-config")
+			testutils.ResetConfigFile(filename, []byte(content))
+
+			cm := configmanager.New()
+			if err := cm.LoadFromFile(filename); err != nil {
+				t.Fatalf("Error loading config: %v", err)
+			}
+			if host := cm.GetStringOr("database.host", ""); host != "localhost" {
+				t.Errorf("Expected host localhost, got %q", host)
+			}
+			if port := cm.GetIntOr("database.port", 0); port != 5432 {
+				t.Errorf("Expected port 5432, got %d", port)
+			}
+
+			// Saving back to the same file keeps the detected format.
+			if err := cm.UpdateKey("database.host", "db.internal"); err != nil {
+				t.Fatalf("Error updating key: %v", err)
+			}
+			if err := cm.SaveToFile(filename); err != nil {
+				t.Fatalf("Error saving config: %v", err)
+			}
+			reloaded := configmanager.New()
+			if err := reloaded.LoadFromFile(filename); err != nil {
+				t.Fatalf("Error reloading config: %v", err)
+			}
+			if host := reloaded.GetStringOr("database.host", ""); host != "db.internal" {
+				t.Errorf("Expected saved host db.internal, got %q", host)
+			}
+		})
+	}
+}
+
+// TestLoadWithWrongExtension tests that content that fails to decode in the format of its extension is still loaded.
+func TestLoadWithWrongExtension(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.toml")
+	testutils.ResetConfigFile(filename, []byte(detectSamples["json"]))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if port := cm.GetIntOr("database.port", 0); port != 5432 {
+		t.Errorf("Expected port 5432, got %d", port)
+	}
+}
+
+// TestExtensionWinsOverDetection tests that content which decodes in the format of its extension is read in
+// that format, even when another format looks more likely.
+func TestExtensionWinsOverDetection(t *testing.T) {
+	t.Setenv("HOMEX", "/home/app")
+	filename := filepath.Join(t.TempDir(), "app.env")
+	testutils.ResetConfigFile(filename, []byte("db_host=localhost\nhome=${HOMEX}/data\n"))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	expected := map[string]interface{}{
+		"db.host": "localhost",
+		"home":    "/home/app/data",
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+}
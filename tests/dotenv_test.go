@@ -0,0 +1,169 @@
+package configmanager_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/formats"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+// TestLoadDotenvConfig tests the quoting, comments, exports and expansion of .env files.
+func TestLoadDotenvConfig(t *testing.T) {
+	t.Setenv("DOTENV_TEST_USER", "admin")
+	dotenvConfig := []byte(`# Local development settings
+export DATABASE_HOST=localhost
+DATABASE_PORT = 5432 # default port
+DATABASE_USER=${DOTENV_TEST_USER}
+DATABASE_PASSWORD='pa$$word # not a comment'
+DATABASE_URL="postgres://${DATABASE_USER}@$DATABASE_HOST:${DATABASE_PORT}/app"
+DATABASE_SCHEMA=${DATABASE_SCHEMA_UNSET:-public}
+APP_GREETING="Hello,\n\"world\""
+APP_CERT="-----BEGIN-----
+abc
+-----END-----"
+APP_PRICE="\$5"
+`)
+	testutils.ResetConfigFile("../config/config.env", dotenvConfig)
+
+	cm := configmanager.New()
+	config := &formats.DotenvConfig{}
+	if err := cm.LoadFromFile("../config/config.env", config); err != nil {
+		t.Fatalf("Error loading dotenv config: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"database.host":     "localhost",
+		"database.port":     "5432",
+		"database.user":     "admin",
+		"database.password": "pa$$word # not a comment",
+		"database.url":      "postgres://admin@localhost:5432/app",
+		"database.schema":   "public",
+		"app.greeting":      "Hello,\n\"world\"",
+		"app.cert":          "-----BEGIN-----\nabc\n-----END-----",
+		"app.price":         "$5",
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+
+	if port := cm.GetIntOr("database.port", 0); port != 5432 {
+		t.Errorf("Expected port 5432, got %d", port)
+	}
+	if line := config.KeyLines()["app.price"]; line != 12 {
+		t.Errorf("Expected app.price on line 12, got %d", line)
+	}
+}
+
+// TestDotenvInvalid tests that malformed .env files are rejected with their line number.
+func TestDotenvInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"missing separator": "A=1\nDATABASE_HOST localhost\n",
+		"unterminated":      "A=1\nDATABASE_HOST=\"localhost\n",
+		"trailing text":     "A=1\nDATABASE_HOST='localhost' extra\n",
+	} {
+		_, err := formats.Dotenv.Decode([]byte(content))
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		} else if !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("%s: expected the error to name line 2, got %v", name, err)
+		}
+	}
+}
+
+// TestDotenvKeysBelowValues tests variables whose key is the prefix of another variable's key.
+func TestDotenvKeysBelowValues(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), ".env")
+	testutils.ResetConfigFile(filename, []byte("DATABASE=postgres\nDATABASE_HOST=localhost\n"))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading dotenv config: %v", err)
+	}
+	expected := map[string]interface{}{
+		"database":      "postgres",
+		"database.host": "localhost",
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+
+	if err := cm.UpdateKey("database", "mysql"); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving dotenv config: %v", err)
+	}
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error reading saved config: %v", err)
+	}
+	if expected := "DATABASE=mysql\nDATABASE_HOST=localhost\n"; string(saved) != expected {
+		t.Errorf("Unexpected saved content:\n%s\nexpected:\n%s", saved, expected)
+	}
+}
+
+// TestDetectMixedCaseDotenv tests that a file without an extension holding a few lower-case names is still
+// read as dotenv, with its names mapped to keys and its references expanded.
+func TestDetectMixedCaseDotenv(t *testing.T) {
+	t.Setenv("HOMEX", "/home/app")
+	filename := filepath.Join(t.TempDir(), "settings")
+	testutils.ResetConfigFile(filename, []byte("DB_HOST=localhost\nDB_PORT=5432\nlog_level=debug\nHOME_DIR=${HOMEX}/data\n"))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	expected := map[string]interface{}{
+		"db.host":   "localhost",
+		"db.port":   "5432",
+		"log.level": "debug",
+		"home.dir":  "/home/app/data",
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+}
+
+// TestSaveDotenvConfig tests writing a ConfigManager back to a .env file.
+func TestSaveDotenvConfig(t *testing.T) {
+	cm := configmanager.New()
+	if err := cm.SetLayer(configmanager.LayerOverrides, configmanager.PriorityOverride, map[string]interface{}{
+		"database.host":  "localhost",
+		"database.port":  5432,
+		"app.motd":       "Hello $USER # welcome",
+		"app.tags":       []interface{}{"a", "b"},
+		"app.multi_line": "one\ntwo",
+	}); err != nil {
+		t.Fatalf("Error setting layer: %v", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), ".env.local")
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving dotenv config: %v", err)
+	}
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error reading saved config: %v", err)
+	}
+	expected := `APP_MOTD="Hello \$USER # welcome"
+APP_MULTI_LINE="one\ntwo"
+APP_TAGS="a, b"
+DATABASE_HOST=localhost
+DATABASE_PORT=5432
+`
+	if string(saved) != expected {
+		t.Errorf("Unexpected saved content:\n%s\nexpected:\n%s", saved, expected)
+	}
+
+	reloaded := configmanager.New()
+	if err := reloaded.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	if motd := reloaded.GetStringOr("app.motd", ""); motd != "Hello $USER # welcome" {
+		t.Errorf("Expected the message to survive a round trip, got %q", motd)
+	}
+	if tags := reloaded.GetStringSliceOr("app.tags", nil); len(tags) != 2 || tags[1] != "b" {
+		t.Errorf("Expected tags [a b], got %v", tags)
+	}
+	if port := reloaded.GetIntOr("database.port", 0); port != 5432 {
+		t.Errorf("Expected port 5432, got %d", port)
+	}
+}
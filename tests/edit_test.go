@@ -0,0 +1,379 @@
+package configmanager_test
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/formats"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+// editCases holds, per format, a hand-maintained document and the document
+// expected after setting database.port to 6543, removing database.user and
+// adding database.pool.
+var editCases = map[string]struct {
+	original, expected string
+}{
+	"config.yaml": {
+		original: `# Application settings
+app:
+  name: "demo" # quoted on purpose
+
+# Database settings
+database:
+  port: 5432
+  user: dbuser
+  host: localhost
+`,
+		expected: `# Application settings
+app:
+  name: "demo" # quoted on purpose
+
+# Database settings
+database:
+  port: 6543
+  host: localhost
+  pool: 10
+`,
+	},
+	"config.env": {
+		original: `# Application settings
+export APP_NAME="demo" # quoted on purpose
+
+# Database settings
+DATABASE_PORT=5432
+DATABASE_USER=dbuser
+DATABASE_HOST=localhost
+`,
+		expected: `# Application settings
+export APP_NAME="demo" # quoted on purpose
+
+# Database settings
+DATABASE_PORT=6543
+DATABASE_HOST=localhost
+DATABASE_POOL=10
+`,
+	},
+	"config.properties": {
+		original: `# Application settings
+app.name = demo
+
+! Database settings
+database.port : 5432
+database.user = dbuser
+database.host = \
+    localhost
+`,
+		expected: `# Application settings
+app.name = demo
+
+! Database settings
+database.port : 6543
+database.host = \
+    localhost
+database.pool=10
+`,
+	},
+	"config.hcl": {
+		original: `# Application settings
+app {
+  name = "demo" # quoted on purpose
+}
+
+# Database settings
+database {
+  port = 5432
+  user = "dbuser"
+  host = "localhost"
+}
+`,
+		expected: `# Application settings
+app {
+  name = "demo" # quoted on purpose
+}
+
+# Database settings
+database {
+  port = 6543
+  host = "localhost"
+  pool = 10
+}
+`,
+	},
+	"config.toml": {
+		original: `# Application settings
+[app]
+name = "demo"   # padded on purpose
+
+# Database settings
+[database]
+port = 5432 # default port
+user = "dbuser"
+host = "localhost"
+
+[server]
+hosts = [
+  "a", # first
+  "b",
+]
+`,
+		expected: `# Application settings
+[app]
+name = "demo"   # padded on purpose
+
+# Database settings
+[database]
+port = 6543 # default port
+host = "localhost"
+pool = 10
+
+[server]
+hosts = [
+  "a", # first
+  "b",
+]
+`,
+	},
+	"config.ini": {
+		original: `; Application settings
+[app]
+name=demo
+
+; Database settings
+[database]
+port = 5432 ; default port
+user = dbuser
+host = localhost
+`,
+		expected: `; Application settings
+[app]
+name=demo
+
+; Database settings
+[database]
+port = 6543 ; default port
+host = localhost
+pool = 10
+`,
+	},
+	"config.json": {
+		original: `{
+    "app": {"name": "demo"},
+    "database": {
+        "port": 5432,
+        "user": "dbuser",
+        "host": "localhost"
+    }
+}
+`,
+		expected: `{
+    "app": {"name": "demo"},
+    "database": {
+        "port": 6543,
+        "host": "localhost",
+        "pool": 10
+    }
+}
+`,
+	},
+}
+
+// TestEditModePreservesDocument tests that edit mode only rewrites changed values.
+func TestEditModePreservesDocument(t *testing.T) {
+	dir := t.TempDir()
+	for name, tc := range editCases {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(dir, name)
+			testutils.ResetConfigFile(filename, []byte(tc.original))
+
+			cm := configmanager.New()
+			cm.SetEditMode(true)
+			if err := cm.LoadFromFile(filename); err != nil {
+				t.Fatalf("Error loading config: %v", err)
+			}
+			if err := cm.UpdateKey("database.port", 6543); err != nil {
+				t.Fatalf("Error updating key: %v", err)
+			}
+			data := cm.GetData()
+			delete(data, "database.user")
+			data["database.pool"] = 10
+			if err := cm.SetLayer(configmanager.LayerOverrides, configmanager.PriorityOverride, data); err != nil {
+				t.Fatalf("Error setting overrides: %v", err)
+			}
+			if err := cm.RemoveLayer(filename); err != nil {
+				t.Fatalf("Error removing file layer: %v", err)
+			}
+			if err := cm.SaveToFile(filename); err != nil {
+				t.Fatalf("Error saving config: %v", err)
+			}
+
+			saved, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatalf("Error reading saved config: %v", err)
+			}
+			if string(saved) != tc.expected {
+				t.Errorf("Unexpected saved content:\n%s\nexpected:\n%s", saved, tc.expected)
+			}
+		})
+	}
+}
+
+// TestEditModeDisabled tests that files are rewritten from scratch by default.
+func TestEditModeDisabled(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.toml")
+	testutils.ResetConfigFile(filename, []byte(editCases["config.toml"].original))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error reading saved config: %v", err)
+	}
+	if string(saved) == editCases["config.toml"].original {
+		t.Error("Expected comments to be dropped without edit mode")
+	}
+}
+
+// TestDynamicConfigOriginal tests patching through DynamicConfig directly.
+func TestDynamicConfigOriginal(t *testing.T) {
+	original := []byte("# comment\nname: demo\nport: 80\n")
+	dc := &configmanager.DynamicConfig{Filename: "config.yaml", Original: original}
+	if err := dc.Load(original); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	dc.Data["port"] = 8080
+
+	saved, err := dc.Save()
+	if err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+	if expected := "# comment\nname: demo\nport: 8080\n"; string(saved) != expected {
+		t.Errorf("Unexpected saved content:\n%s", saved)
+	}
+}
+
+// TestJSONPatchKeepsLayout tests that editing a JSON document only rewrites the
+// values that changed, leaving objects and arrays written on one line as they are.
+func TestJSONPatchKeepsLayout(t *testing.T) {
+	original := `{
+  "server": {"host": "a", "ports": [80, 443]},
+  "tags": ["x", "y"],
+  "limits": {"cpu": 1, "mem": 2},
+  "extra": {},
+  "name": "demo"
+}
+`
+	for _, tc := range []struct {
+		name     string
+		original string
+		data     map[string]interface{}
+		expected string
+	}{
+		{
+			name:     "scalar",
+			original: original,
+			data: map[string]interface{}{
+				"server": map[string]interface{}{"host": "a", "ports": []interface{}{80, 443}},
+				"tags":   []interface{}{"x", "y"},
+				"limits": map[string]interface{}{"cpu": 1, "mem": 2},
+				"extra":  map[string]interface{}{},
+				"name":   "renamed",
+			},
+			expected: strings.Replace(original, `"demo"`, `"renamed"`, 1),
+		},
+		{
+			name:     "inline",
+			original: original,
+			data: map[string]interface{}{
+				"server": map[string]interface{}{"host": "b", "ports": []interface{}{80, 443}},
+				"tags":   []interface{}{"x", "z"},
+				"limits": map[string]interface{}{"mem": 2, "disk": 3},
+				"extra":  map[string]interface{}{"debug": true},
+				"name":   "demo",
+			},
+			expected: `{
+  "server": {"host": "b", "ports": [80, 443]},
+  "tags": ["x","z"],
+  "limits": {"mem": 2, "disk": 3},
+  "extra": {
+    "debug": true
+  },
+  "name": "demo"
+}
+`,
+		},
+		{
+			name:     "single line",
+			original: `{"a":1,"b":2,"a":3}`,
+			data:     map[string]interface{}{"a": 3, "c": []interface{}{1, 2}},
+			expected: `{"a":3,"c":[1,2]}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			patched, err := formats.Patch(formats.JSON, []byte(tc.original), tc.data)
+			if err != nil {
+				t.Fatalf("Error patching JSON: %v", err)
+			}
+			if string(patched) != tc.expected {
+				t.Errorf("Unexpected patched document:\n%s\nexpected:\n%s", patched, tc.expected)
+			}
+		})
+	}
+}
+
+// plainFormat is a format that cannot edit documents in place.
+type plainFormat struct{ kvFormat }
+
+func (plainFormat) Name() string         { return "kv-plain" }
+func (plainFormat) Extensions() []string { return []string{".kvp"} }
+func (plainFormat) MIMETypes() []string  { return nil }
+
+// TestEditModeFallback tests that a file that cannot be edited in place is only rewritten when allowed.
+func TestEditModeFallback(t *testing.T) {
+	if _, ok := formats.ForExtension(".kvp"); !ok {
+		if err := configmanager.RegisterFormat(plainFormat{}); err != nil {
+			t.Fatalf("Error registering format: %v", err)
+		}
+	}
+	original := "# comment\nname=demo\n"
+	filename := filepath.Join(t.TempDir(), "app.kvp")
+	testutils.ResetConfigFile(filename, []byte(original))
+
+	var buf bytes.Buffer
+	cm := configmanager.New(configmanager.WithEditMode(), configmanager.WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if err := cm.UpdateKey("name", "updated"); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+
+	if err := cm.SaveToFile(filename); !errors.Is(err, formats.ErrNotPatchable) {
+		t.Fatalf("Expected ErrNotPatchable, got %v", err)
+	}
+	if saved, _ := os.ReadFile(filename); string(saved) != original {
+		t.Errorf("Expected the file to be left untouched, got:\n%s", saved)
+	}
+
+	cm.SetEditFallback(true)
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+	if saved, _ := os.ReadFile(filename); string(saved) != "name=updated\n" {
+		t.Errorf("Unexpected saved content:\n%s", saved)
+	}
+	if !strings.Contains(buf.String(), "level=WARN") {
+		t.Errorf("Expected the rewrite to be logged as a warning:\n%s", buf.String())
+	}
+}
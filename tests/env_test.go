@@ -0,0 +1,195 @@
+package configmanager_test
+
+import (
+	"bytes"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+func loadEnvFixture(t *testing.T, opts ...configmanager.Option) *configmanager.ConfigManager {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	testutils.ResetConfigFile(filename, []byte("server:\n  port: 8080\n  debug: false\n  ratio: 0.5\n  hosts: [a, b]\n  ports: [80, 443]\ndatabase:\n  host: localhost\n"))
+
+	cm := configmanager.New(opts...)
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	return cm
+}
+
+// TestLoadEnvCoercesTypes tests that variables take the type of the values they override.
+func TestLoadEnvCoercesTypes(t *testing.T) {
+	cm := loadEnvFixture(t)
+	t.Setenv("CONFIG_SERVER_PORT", "9090")
+	t.Setenv("CONFIG_SERVER_DEBUG", "true")
+	t.Setenv("CONFIG_SERVER_RATIO", "0.75")
+	t.Setenv("CONFIG_SERVER_HOSTS", "x, y, z")
+	t.Setenv("CONFIG_SERVER_PORTS", "8080,8443")
+	t.Setenv("DATABASE_HOST", "ignored without the prefix")
+
+	if err := cm.LoadEnv(); err != nil {
+		t.Fatalf("Error loading env: %v", err)
+	}
+	testutils.AssertConfig(t, map[string]interface{}{
+		"server.port":   9090,
+		"server.debug":  true,
+		"server.ratio":  0.75,
+		"server.hosts":  []interface{}{"x", "y", "z"},
+		"server.ports":  []interface{}{8080, 8443},
+		"database.host": "localhost",
+	}, cm.GetData())
+
+	if origin, _ := cm.Origin("server.port"); origin.EnvVar != "CONFIG_SERVER_PORT" {
+		t.Errorf("Unexpected origin for server.port: %+v", origin)
+	}
+}
+
+// TestLoadEnvIntegerForms tests that variables accept the integer forms GetInt
+// does, so 0x1F overrides an int rather than being rejected.
+func TestLoadEnvIntegerForms(t *testing.T) {
+	cm := loadEnvFixture(t)
+	t.Setenv("CONFIG_SERVER_PORT", "0x1F")
+	t.Setenv("CONFIG_SERVER_PORTS", "010,0o17")
+	t.Setenv("CONFIG_SERVER_RATIO", " 1e-1 ")
+	if err := cm.LoadEnv(); err != nil {
+		t.Fatalf("Error loading env: %v", err)
+	}
+	testutils.AssertConfig(t, map[string]interface{}{
+		"server.port":   31,
+		"server.debug":  false,
+		"server.ratio":  0.1,
+		"server.hosts":  []interface{}{"a", "b"},
+		"server.ports":  []interface{}{10, 15},
+		"database.host": "localhost",
+	}, cm.GetData())
+}
+
+// TestLoadEnvInvalidValue tests that a value that cannot be converted changes nothing.
+func TestLoadEnvInvalidValue(t *testing.T) {
+	cm := loadEnvFixture(t)
+	t.Setenv("CONFIG_DATABASE_HOST", "db.internal")
+	t.Setenv("CONFIG_SERVER_PORT", "eighty")
+
+	err := cm.LoadEnv()
+	if err == nil || !strings.Contains(err.Error(), "CONFIG_SERVER_PORT") {
+		t.Fatalf("Expected an error naming CONFIG_SERVER_PORT, got %v", err)
+	}
+	if host := cm.GetStringOr("database.host", ""); host != "localhost" {
+		t.Errorf("Expected database.host to be unchanged, got %q", host)
+	}
+}
+
+// TestLoadEnvInvalidSecret tests that an invalid value of a secret key is left out of the error and the log.
+func TestLoadEnvInvalidSecret(t *testing.T) {
+	var buf bytes.Buffer
+	cm := configmanager.New(configmanager.WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	if err := cm.SetDefaults(map[string]interface{}{"server.password": 0}); err != nil {
+		t.Fatalf("Error setting defaults: %v", err)
+	}
+	t.Setenv("CONFIG_SERVER_PASSWORD", "hunter2")
+
+	err := cm.LoadEnv()
+	if err == nil || !strings.Contains(err.Error(), "CONFIG_SERVER_PASSWORD") {
+		t.Fatalf("Expected an error naming CONFIG_SERVER_PASSWORD, got %v", err)
+	}
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("Error leaks the secret: %v", err)
+	}
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("Log output leaks the secret:\n%s", buf.String())
+	}
+}
+
+// TestLoadEnvOptions tests prefixes, naming functions, new keys and list separators.
+func TestLoadEnvOptions(t *testing.T) {
+	cm := loadEnvFixture(t, configmanager.WithEnvPrefix("myapp"))
+	t.Setenv("MYAPP_SERVER_PORT", "9090")
+	t.Setenv("MYAPP_CACHE_TTL", "5m")
+	t.Setenv("MYAPP_SERVER_HOSTS", "x;y")
+	if err := cm.LoadEnv(configmanager.EnvAllowNew(), configmanager.EnvListSeparator(";")); err != nil {
+		t.Fatalf("Error loading env: %v", err)
+	}
+	testutils.AssertConfig(t, map[string]interface{}{
+		"server.port":  9090,
+		"server.hosts": []interface{}{"x", "y"},
+		"cache.ttl":    "5m",
+	}, cm.GetData())
+
+	// Loading again replaces the env layer, so keys only the old layer added disappear.
+	t.Setenv("APP__DATABASE__HOST", "db.internal")
+	name := configmanager.EnvNameFunc(func(key string) string {
+		return "APP__" + strings.ToUpper(strings.ReplaceAll(key, ".", "__"))
+	})
+	if err := cm.LoadEnv(configmanager.EnvPrefix(""), name); err != nil {
+		t.Fatalf("Error loading env: %v", err)
+	}
+	if cm.Has("cache.ttl") {
+		t.Errorf("Expected cache.ttl to be removed with the env layer")
+	}
+	if port := cm.GetIntOr("server.port", 0); port != 8080 {
+		t.Errorf("Expected server.port to be back to 8080, got %d", port)
+	}
+	if host := cm.GetStringOr("database.host", ""); host != "db.internal" {
+		t.Errorf("Expected database.host from APP__DATABASE__HOST, got %q", host)
+	}
+
+	if err := cm.LoadEnv(configmanager.EnvPrefix(""), configmanager.EnvAllowNew()); err == nil {
+		t.Errorf("Expected an error adding new keys without a prefix")
+	}
+}
+
+// TestLoadEnvVariablesCompat tests that the deprecated loader keeps reading unprefixed strings.
+func TestLoadEnvVariablesCompat(t *testing.T) {
+	cm := loadEnvFixture(t)
+	t.Setenv("SERVER_PORT", "9090")
+
+	config := &configmanager.DynamicConfig{Data: cm.GetData()}
+	if err := cm.LoadEnvVariables(config); err != nil {
+		t.Fatalf("Error loading env variables: %v", err)
+	}
+	if !reflect.DeepEqual(config.Data["server.port"], "9090") || cm.GetData()["server.port"] != "9090" {
+		t.Errorf("Expected server.port to be the string 9090, got %v", config.Data["server.port"])
+	}
+}
+
+// TestLoadEnvNewKeyConflicts tests that new keys which would collide with
+// existing ones are ignored, so the configuration can still be saved.
+func TestLoadEnvNewKeyConflicts(t *testing.T) {
+	var buf bytes.Buffer
+	cm := loadEnvFixture(t, configmanager.WithEnvPrefix("myapp"), configmanager.WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	t.Setenv("MYAPP_SERVER", "x")
+	t.Setenv("MYAPP_SERVER_PORT_EXTRA", "y")
+	t.Setenv("MYAPP_CACHE", "on")
+	t.Setenv("MYAPP_CACHE_TTL", "5m")
+	if err := cm.LoadEnv(configmanager.EnvAllowNew()); err != nil {
+		t.Fatalf("Error loading env: %v", err)
+	}
+
+	for _, key := range []string{"server", "server.port.extra", "cache.ttl"} {
+		if _, ok := cm.GetData()[key]; ok {
+			t.Errorf("Expected conflicting key %s to be ignored", key)
+		}
+	}
+	if cache := cm.GetStringOr("cache", ""); cache != "on" {
+		t.Errorf("Expected cache from MYAPP_CACHE, got %q", cache)
+	}
+	if !strings.Contains(buf.String(), "ignored environment variable") {
+		t.Errorf("Expected the ignored variables to be logged:\n%s", buf.String())
+	}
+
+	var out bytes.Buffer
+	if err := cm.SaveToWriter(&out, "yaml"); err != nil {
+		t.Errorf("Error saving config: %v", err)
+	}
+	var config map[string]interface{}
+	if err := cm.Unmarshal(&config); err != nil {
+		t.Errorf("Error unmarshalling config: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package configmanager_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/formats"
+	"github.com/1broseidon/configmanager/internal"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+// kvFormat is a minimal "key=value" format used to exercise the registry.
+type kvFormat struct{}
+
+func (kvFormat) Name() string         { return "kv" }
+func (kvFormat) Extensions() []string { return []string{".kv"} }
+func (kvFormat) MIMETypes() []string  { return []string{"text/x-kv"} }
+
+func (kvFormat) Decode(data []byte) (map[string]interface{}, error) {
+	flat := make(map[string]interface{})
+	for _, line := range strings.Split(string(data), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			flat[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return internal.Unflatten(flat)
+}
+
+func (kvFormat) Encode(data map[string]interface{}) ([]byte, error) {
+	var lines []string
+	for k, v := range internal.Flatten(data) {
+		lines = append(lines, k+"="+v.(string))
+	}
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// TestRegisterFormat tests that a registered format is used by LoadFromFile and SaveToFile.
+func TestRegisterFormat(t *testing.T) {
+	if err := configmanager.RegisterFormat(kvFormat{}); err != nil {
+		t.Fatalf("Error registering format: %v", err)
+	}
+	if f, ok := formats.ForMIMEType("text/x-kv; charset=utf-8"); !ok || f.Name() != "kv" {
+		t.Errorf("Expected kv format for MIME type, got %v", f)
+	}
+
+	filename := filepath.Join(t.TempDir(), "app.kv")
+	testutils.ResetConfigFile(filename, []byte("database.host=localhost\ndatabase.user=dbuser\n"))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if err := cm.UpdateKey("database.user", "admin"); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error reading saved config: %v", err)
+	}
+	if string(saved) != "database.host=localhost\ndatabase.user=admin\n" {
+		t.Errorf("Unexpected saved content:\n%s", saved)
+	}
+}
+
+// TestBuiltinFormatsRegistered tests the default registrations.
+func TestBuiltinFormatsRegistered(t *testing.T) {
+	for ext, name := range map[string]string{".json": "json", ".yml": "yaml", "YAML": "yaml", ".toml": "toml", "ini": "ini"} {
+		f, ok := formats.ForExtension(ext)
+		if !ok || f.Name() != name {
+			t.Errorf("Expected %s format for %s, got %v", name, ext, f)
+		}
+	}
+	if f, ok := configmanager.LookupFormat("toml"); !ok || f != formats.TOML {
+		t.Errorf("Expected TOML format from LookupFormat, got %v", f)
+	}
+
+	dc := &configmanager.DynamicConfig{Filename: "config.unknown"}
+	if err := dc.Load([]byte("just some text")); !errors.Is(err, configmanager.ErrUnsupportedFormat) {
+		t.Errorf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+// TestINIRoundTripSections tests that DynamicConfig writes INI sections rather than stringified maps.
+func TestINIRoundTripSections(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.ini")
+	testutils.ResetConfigFile(filename, []byte("name = app\n\n[database]\nhost = localhost\nport = 5432\n"))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+
+	reloaded := configmanager.New()
+	if err := reloaded.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	expected := map[string]interface{}{
+		"name":          "app",
+		"database.host": "localhost",
+		"database.port": "5432",
+	}
+	testutils.AssertConfig(t, expected, reloaded.GetData())
+}
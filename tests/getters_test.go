@@ -0,0 +1,136 @@
+package configmanager_test
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+// TestTypedGettersAcrossFormats checks that the same logical values read back identically from every format.
+func TestTypedGettersAcrossFormats(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{"server": {"port": 8080, "debug": true, "timeout": "5s", "ratio": 0.5, "tags": ["a", "b"]}}`,
+		"config.yaml": "server:\n  port: 8080\n  debug: true\n  timeout: 5s\n  ratio: 0.5\n  tags: [a, b]\n",
+		"config.toml": "[server]\nport = 8080\ndebug = true\ntimeout = \"5s\"\nratio = 0.5\ntags = [\"a\", \"b\"]\n",
+		"config.ini":  "[server]\nport = 8080\ndebug = true\ntimeout = 5s\nratio = 0.5\ntags = a, b\n",
+	}
+
+	dir := t.TempDir()
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(dir, name)
+			testutils.ResetConfigFile(filename, []byte(content))
+
+			cm := configmanager.New()
+			if err := cm.LoadFromFile(filename); err != nil {
+				t.Fatalf("Error loading config: %v", err)
+			}
+
+			if port, err := cm.GetInt("server.port"); err != nil || port != 8080 {
+				t.Errorf("GetInt: got %v, %v", port, err)
+			}
+			if port, err := cm.GetInt64("server.port"); err != nil || port != 8080 {
+				t.Errorf("GetInt64: got %v, %v", port, err)
+			}
+			if port, err := cm.GetString("server.port"); err != nil || port != "8080" {
+				t.Errorf("GetString: got %q, %v", port, err)
+			}
+			if debug, err := cm.GetBool("server.debug"); err != nil || !debug {
+				t.Errorf("GetBool: got %v, %v", debug, err)
+			}
+			if timeout, err := cm.GetDuration("server.timeout"); err != nil || timeout != 5*time.Second {
+				t.Errorf("GetDuration: got %v, %v", timeout, err)
+			}
+			if ratio, err := cm.GetFloat64("server.ratio"); err != nil || ratio != 0.5 {
+				t.Errorf("GetFloat64: got %v, %v", ratio, err)
+			}
+			if tags, err := cm.GetStringSlice("server.tags"); err != nil || !reflect.DeepEqual(tags, []string{"a", "b"}) {
+				t.Errorf("GetStringSlice: got %v, %v", tags, err)
+			}
+		})
+	}
+}
+
+// TestTypedGetterErrors checks that missing keys and bad conversions return errors rather than panicking.
+func TestTypedGetterErrors(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	testutils.ResetConfigFile(filename, []byte(`{"server": {"host": "localhost", "ratio": 1.5}}`))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	if _, err := cm.GetInt("server.missing"); !errors.Is(err, configmanager.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if _, err := cm.GetInt("server.host"); err == nil {
+		t.Errorf("Expected conversion error for non-numeric string")
+	}
+	if _, err := cm.GetInt("server.ratio"); err == nil {
+		t.Errorf("Expected conversion error for fractional float")
+	}
+	if got := cm.GetIntOr("server.missing", 42); got != 42 {
+		t.Errorf("GetIntOr: expected default 42, got %d", got)
+	}
+	if got := cm.GetStringOr("server.host", "default"); got != "localhost" {
+		t.Errorf("GetStringOr: expected localhost, got %q", got)
+	}
+}
+
+// TestGetIntStrings checks that numeric strings are decimal unless they carry an explicit base prefix.
+func TestGetIntStrings(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.ini")
+	testutils.ResetConfigFile(filename, []byte("[modes]\nleading = 010\neight = 08\nwide = 0070\nhex = 0x1F\noctal = 0o17\nnegative = -012\n"))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	expected := map[string]int{
+		"modes.leading":  10,
+		"modes.eight":    8,
+		"modes.wide":     70,
+		"modes.hex":      31,
+		"modes.octal":    15,
+		"modes.negative": -12,
+	}
+	for key, want := range expected {
+		if got, err := cm.GetInt(key); err != nil || got != want {
+			t.Errorf("GetInt(%s): expected %d, got %d, %v", key, want, got, err)
+		}
+	}
+}
+
+// TestGetStringMap checks that a section is returned as a nested map.
+func TestGetStringMap(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	testutils.ResetConfigFile(filename, []byte("database:\n  host: localhost\n  pool:\n    size: 10\n"))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	section, err := cm.GetStringMap("database")
+	if err != nil {
+		t.Fatalf("GetStringMap: %v", err)
+	}
+	expected := map[string]interface{}{
+		"host": "localhost",
+		"pool": map[string]interface{}{"size": 10},
+	}
+	if !reflect.DeepEqual(section, expected) {
+		t.Errorf("Expected %v, got %v", expected, section)
+	}
+
+	if _, err := cm.GetStringMap("cache"); !errors.Is(err, configmanager.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package configmanager_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/formats"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+// TestLoadHCLConfig tests that attributes, nested and labeled blocks are flattened.
+func TestLoadHCLConfig(t *testing.T) {
+	hclConfig := []byte(`# Ops tool settings
+region = "eu-west-1"
+debug  = true
+
+database {
+  host = "localhost"
+  port = 5432
+  pool {
+    size = 10
+  }
+}
+
+service "web" {
+  port    = 80
+  ratio   = 0.5
+  aliases = ["www", "app"]
+}
+
+service "api" {
+  port = 8080
+  tags = {
+    team = "core"
+  }
+}
+`)
+	testutils.ResetConfigFile("../config/config.hcl", hclConfig)
+
+	cm := configmanager.New()
+	config := &formats.HCLConfig{}
+	if err := cm.LoadFromFile("../config/config.hcl", config); err != nil {
+		t.Fatalf("Error loading HCL config: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"region":                "eu-west-1",
+		"debug":                 true,
+		"database.host":         "localhost",
+		"database.port":         int64(5432),
+		"database.pool.size":    int64(10),
+		"service.web.port":      int64(80),
+		"service.web.ratio":     0.5,
+		"service.web.aliases":   []interface{}{"www", "app"},
+		"service.api.port":      int64(8080),
+		"service.api.tags.team": "core",
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+
+	if line := config.KeyLines()["service.api.tags.team"]; line != 22 {
+		t.Errorf("Expected service.api.tags.team on line 22, got %d", line)
+	}
+}
+
+// TestLoadTFVars tests .tfvars files and repeated blocks, which become lists.
+func TestLoadTFVars(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "prod.tfvars")
+	testutils.ResetConfigFile(filename, []byte(`
+instance_type = "t3.micro"
+zones         = ["a", "b"]
+
+listener {
+  port = 80
+}
+
+listener {
+  port = 443
+}
+`))
+
+	cm := configmanager.New(configmanager.WithArrayIndexing())
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading tfvars: %v", err)
+	}
+	if port := cm.GetIntOr("listener.1.port", 0); port != 443 {
+		t.Errorf("Expected the second listener on port 443, got %d", port)
+	}
+	if zones := cm.GetStringSliceOr("zones", nil); len(zones) != 2 || zones[1] != "b" {
+		t.Errorf("Expected zones [a b], got %v", zones)
+	}
+}
+
+// TestHCLInvalid tests that expressions needing evaluation and conflicting blocks are rejected.
+func TestHCLInvalid(t *testing.T) {
+	if _, err := formats.HCL.Decode([]byte("name = var.name\n")); err == nil {
+		t.Error("Expected a variable reference to be rejected")
+	}
+
+	var conflict *configmanager.KeyConflictError
+	_, err := formats.HCL.Decode([]byte("service = 1\nservice \"web\" {\n  port = 80\n}\n"))
+	if !errors.As(err, &conflict) {
+		t.Errorf("Expected a KeyConflictError, got %v", err)
+	}
+}
+
+// TestSaveHCLConfig tests writing a ConfigManager back to an HCL file.
+func TestSaveHCLConfig(t *testing.T) {
+	cm := configmanager.New()
+	if err := cm.SetLayer(configmanager.LayerOverrides, configmanager.PriorityOverride, map[string]interface{}{
+		"region":            "eu-west-1",
+		"database.host":     "localhost",
+		"database.port":     int64(5432),
+		"labels.app name":   "demo",
+		"service.web.port":  int64(80),
+		"service.web.hosts": []interface{}{"a", "b"},
+	}); err != nil {
+		t.Fatalf("Error setting layer: %v", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "config.hcl")
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving HCL config: %v", err)
+	}
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error reading saved config: %v", err)
+	}
+	expected := `labels = {
+  "app name" = "demo"
+}
+region = "eu-west-1"
+
+database {
+  host = "localhost"
+  port = 5432
+}
+
+service {
+  web {
+    hosts = ["a", "b"]
+    port  = 80
+  }
+}
+`
+	if string(saved) != expected {
+		t.Errorf("Unexpected saved content:\n%s\nexpected:\n%s", saved, expected)
+	}
+
+	reloaded := configmanager.New()
+	if err := reloaded.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	testutils.AssertConfig(t, cm.GetData(), reloaded.GetData())
+}
+
+// TestSaveHCLLabeledBlocks tests that a plain save writes labeled blocks back
+// with their labels, including repeated and nested ones.
+func TestSaveHCLLabeledBlocks(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "source.hcl")
+	testutils.ResetConfigFile(source, []byte(`service "web" {
+  port = 80
+
+  listener "tcp" "public" {
+    address = "0.0.0.0"
+  }
+}
+
+service "api" {
+  port = 8080
+}
+
+rule "allow" {
+  cidr = "10.0.0.0/8"
+}
+
+rule "allow" {
+  cidr = "192.168.0.0/16"
+}
+`))
+
+	for _, tc := range []struct {
+		name   string
+		config []configmanager.ConfigSaver
+	}{
+		{name: "dynamic"},
+		{name: "hcl", config: []configmanager.ConfigSaver{&formats.HCLConfig{}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cm := configmanager.New()
+			if err := cm.LoadFromFile(source); err != nil {
+				t.Fatalf("Error loading HCL config: %v", err)
+			}
+			if err := cm.Set("service.api.port", int64(9090)); err != nil {
+				t.Fatalf("Error setting port: %v", err)
+			}
+
+			filename := filepath.Join(t.TempDir(), "saved.hcl")
+			if err := cm.SaveToFile(filename, tc.config...); err != nil {
+				t.Fatalf("Error saving HCL config: %v", err)
+			}
+			saved, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatalf("Error reading saved config: %v", err)
+			}
+			expected := `rule "allow" {
+  cidr = "10.0.0.0/8"
+}
+
+rule "allow" {
+  cidr = "192.168.0.0/16"
+}
+
+service "api" {
+  port = 9090
+}
+
+service "web" {
+  port = 80
+
+  listener "tcp" "public" {
+    address = "0.0.0.0"
+  }
+}
+`
+			if string(saved) != expected {
+				t.Errorf("Unexpected saved content:\n%s\nexpected:\n%s", saved, expected)
+			}
+
+			reloaded := configmanager.New()
+			if err := reloaded.LoadFromFile(filename); err != nil {
+				t.Fatalf("Error reloading config: %v", err)
+			}
+			testutils.AssertConfig(t, cm.GetData(), reloaded.GetData())
+		})
+	}
+}
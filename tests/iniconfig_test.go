@@ -1,6 +1,9 @@
 package configmanager_test
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/1broseidon/configmanager"
@@ -40,3 +43,56 @@ port = 8080
 
 	testutils.AssertConfig(t, expected, cm.GetData())
 }
+
+// TestINIDottedNames tests that dotted section and key names are read as key paths.
+func TestINIDottedNames(t *testing.T) {
+	iniConfig := `[server]
+http = on
+tls.port = 443
+
+[server.http]
+port = 80
+`
+	filename := filepath.Join(t.TempDir(), "config.ini")
+	testutils.ResetConfigFile(filename, []byte(iniConfig))
+
+	cm := configmanager.New(configmanager.WithEditMode())
+	config := &formats.INIConfig{}
+	if err := cm.LoadFromFile(filename, config); err != nil {
+		t.Fatalf("Error loading INI config: %v", err)
+	}
+	expected := map[string]interface{}{
+		"server.http":      "on",
+		"server.http.port": "80",
+		"server.tls.port":  "443",
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+	if line := config.KeyLines()["server.http.port"]; line != 6 {
+		t.Errorf("Expected server.http.port on line 6, got %d", line)
+	}
+
+	if err := cm.UpdateKey("server.http.port", 8080); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving INI config: %v", err)
+	}
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error reading saved config: %v", err)
+	}
+	if want := strings.Replace(iniConfig, "port = 80\n", "port = 8080\n", 1); string(saved) != want {
+		t.Errorf("Unexpected saved content:\n%s\nexpected:\n%s", saved, want)
+	}
+
+	rewritten := filepath.Join(t.TempDir(), "rewritten.ini")
+	if err := cm.SaveToFile(rewritten); err != nil {
+		t.Fatalf("Error saving INI config: %v", err)
+	}
+	reloaded := configmanager.New()
+	if err := reloaded.LoadFromFile(rewritten); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	expected["server.http.port"] = "8080"
+	testutils.AssertConfig(t, expected, reloaded.GetData())
+}
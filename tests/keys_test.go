@@ -0,0 +1,140 @@
+package configmanager_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/internal"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+// TestSplitKey tests the escaped and bracketed key syntaxes.
+func TestSplitKey(t *testing.T) {
+	cases := map[string][]string{
+		"database.host":                {"database", "host"},
+		`hosts.example\.com.port`:      {"hosts", "example.com", "port"},
+		`hosts["example.com"].port`:    {"hosts", "example.com", "port"},
+		`hosts['example.com'].port`:    {"hosts", "example.com", "port"},
+		`hosts["a\"b"]`:                {"hosts", `a"b`},
+		`["example.com"]`:              {"example.com"},
+		`paths.C:\\temp`:               {"paths", `C:\temp`},
+		`odd\[key]`:                    {"odd[key]"},
+		`servers[0].host`:              {"servers", "0", "host"},
+		`a["b"]["c"]`:                  {"a", "b", "c"},
+		"unterminated[\"x":             {`unterminated["x`},
+		`hosts["example.com"]rest.end`: {"hosts", "example.com", "rest", "end"},
+	}
+	for key, expected := range cases {
+		if got := internal.SplitKey(key, "."); !reflect.DeepEqual(got, expected) {
+			t.Errorf("SplitKey(%q) = %q, expected %q", key, got, expected)
+		}
+	}
+
+	for _, segments := range cases {
+		key := internal.JoinSegments(segments, ".")
+		if got := internal.SplitKey(key, "."); !reflect.DeepEqual(got, segments) {
+			t.Errorf("SplitKey(JoinSegments(%q)) = %q", segments, got)
+		}
+	}
+}
+
+// TestKeysWithDots tests that keys containing dots survive a load, update and save.
+func TestKeysWithDots(t *testing.T) {
+	for name, content := range map[string]string{
+		"hosts.yaml": "hosts:\n  example.com:\n    port: 443\n  localhost:\n    port: 80\n",
+		"hosts.toml": "[hosts.\"example.com\"]\nport = 443\n\n[hosts.localhost]\nport = 80\n",
+		"hosts.json": `{"hosts": {"example.com": {"port": 443}, "localhost": {"port": 80}}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), name)
+			testutils.ResetConfigFile(filename, []byte(content))
+
+			cm := configmanager.New()
+			if err := cm.LoadFromFile(filename); err != nil {
+				t.Fatalf("Error loading config: %v", err)
+			}
+			if _, ok := cm.GetData()[`hosts.example\.com.port`]; !ok {
+				t.Fatalf("Expected an escaped key in %v", cm.GetData())
+			}
+			if port := cm.GetIntOr(`hosts["example.com"].port`, 0); port != 443 {
+				t.Errorf("Expected port 443, got %d", port)
+			}
+			if origin, ok := cm.Origin(`hosts["example.com"].port`); !ok || origin.File != filename {
+				t.Errorf("Unexpected origin %+v", origin)
+			}
+			if !strings.HasSuffix(name, ".json") {
+				if origin, _ := cm.Origin(`hosts.example\.com.port`); origin.Line == 0 {
+					t.Errorf("Expected a line number for the escaped key")
+				}
+			}
+
+			if err := cm.UpdateKey(`hosts["example.com"].port`, 8443); err != nil {
+				t.Fatalf("Error updating key: %v", err)
+			}
+			if err := cm.SaveToFile(filename); err != nil {
+				t.Fatalf("Error saving config: %v", err)
+			}
+
+			reloaded := configmanager.New()
+			if err := reloaded.LoadFromFile(filename); err != nil {
+				t.Fatalf("Error reloading config: %v", err)
+			}
+			hosts, err := reloaded.GetStringMap("hosts")
+			if err != nil {
+				t.Fatalf("Error reading hosts: %v", err)
+			}
+			if len(hosts) != 2 {
+				t.Errorf("Expected two hosts, got %v", hosts)
+			}
+			if port := reloaded.GetIntOr(`hosts.example\.com.port`, 0); port != 8443 {
+				t.Errorf("Expected saved port 8443, got %d", port)
+			}
+		})
+	}
+}
+
+// TestBracketKeysInLayers tests bracket syntax in keys passed to SetDefaults.
+func TestBracketKeysInLayers(t *testing.T) {
+	cm := configmanager.New()
+	if err := cm.SetDefaults(map[string]interface{}{`hosts["example.com"].port`: 443}); err != nil {
+		t.Fatalf("Error setting defaults: %v", err)
+	}
+	testutils.AssertConfig(t, map[string]interface{}{`hosts.example\.com.port`: 443}, cm.GetData())
+
+	var seen []string
+	done := make(chan struct{})
+	sub := cm.OnChange(`hosts["example.com"]`, func(ev configmanager.ChangeEvent) {
+		for _, c := range ev.Changes {
+			seen = append(seen, c.Key)
+		}
+		close(done)
+	})
+	defer sub.Unsubscribe()
+	if err := cm.UpdateKey(`hosts.example\.com.port`, 8443); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	<-done
+	if len(seen) != 1 || seen[0] != `hosts.example\.com.port` {
+		t.Errorf("Unexpected changes %v", seen)
+	}
+
+}
+
+// TestEnvNamesForKeysWithDots tests that dots within a key segment map to underscores in variable names.
+func TestEnvNamesForKeysWithDots(t *testing.T) {
+	t.Setenv("HOSTS_EXAMPLE_COM_PORT", "9443")
+
+	cm := configmanager.New(configmanager.WithDefaults(map[string]interface{}{`hosts["example.com"].port`: 443}))
+	if err := cm.LoadEnvVariables(&configmanager.DynamicConfig{Data: cm.GetData()}); err != nil {
+		t.Fatalf("Error loading env variables: %v", err)
+	}
+	if origin, _ := cm.Origin(`hosts["example.com"].port`); origin.EnvVar != "HOSTS_EXAMPLE_COM_PORT" {
+		t.Errorf("Unexpected origin %+v", origin)
+	}
+	if port := cm.GetIntOr(`hosts["example.com"].port`, 0); port != 9443 {
+		t.Errorf("Expected port 9443, got %d", port)
+	}
+}
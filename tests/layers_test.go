@@ -0,0 +1,96 @@
+package configmanager_test
+
+import (
+	"flag"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+// TestLayeredFiles tests that an override file is merged over a base file instead of replacing it.
+func TestLayeredFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	override := filepath.Join(dir, "override.json")
+	testutils.ResetConfigFile(base, []byte("database:\n  host: localhost\n  port: 5432\n"))
+	testutils.ResetConfigFile(override, []byte(`{"database": {"host": "db.internal"}}`))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(base); err != nil {
+		t.Fatalf("Error loading base config: %v", err)
+	}
+	if err := cm.LoadFromFile(override); err != nil {
+		t.Fatalf("Error loading override config: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"database.host": "db.internal",
+		"database.port": 5432,
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+
+	// Reloading the base file must not let it jump ahead of the override.
+	testutils.ResetConfigFile(base, []byte("database:\n  host: other\n  port: 6543\n"))
+	if err := cm.LoadFromFile(base); err != nil {
+		t.Fatalf("Error reloading base config: %v", err)
+	}
+	expected["database.port"] = 6543
+	testutils.AssertConfig(t, expected, cm.GetData())
+
+	if !reflect.DeepEqual(cm.Layers(), []string{base, override}) {
+		t.Errorf("Unexpected layer order: %v", cm.Layers())
+	}
+}
+
+// TestLayerPrecedence tests defaults < files < env < flags < runtime overrides.
+func TestLayerPrecedence(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.toml")
+	testutils.ResetConfigFile(filename, []byte("[server]\nhost = \"file\"\nport = 80\nname = \"file\"\n"))
+
+	cm := configmanager.New()
+	err := cm.SetDefaults(map[string]interface{}{
+		"server": map[string]interface{}{"host": "default", "port": 1, "name": "default", "mode": "default"},
+	})
+	if err != nil {
+		t.Fatalf("Error setting defaults: %v", err)
+	}
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("server.port", 0, "server port")
+	fs.String("server.host", "unset", "server host")
+	if err := fs.Parse([]string{"-server.port=9090"}); err != nil {
+		t.Fatalf("Error parsing flags: %v", err)
+	}
+	if err := cm.LoadFlags(fs); err != nil {
+		t.Fatalf("Error loading flags: %v", err)
+	}
+
+	err = cm.SetLayer(configmanager.LayerEnv, configmanager.PriorityEnv, map[string]interface{}{"server.port": "7070", "server.host": "env"})
+	if err != nil {
+		t.Fatalf("Error setting env layer: %v", err)
+	}
+	if err := cm.UpdateKey("server.host", "override"); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"server.mode": "default",
+		"server.name": "file",
+		"server.host": "override",
+		"server.port": 9090,
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+
+	if err := cm.RemoveLayer(configmanager.LayerFlags); err != nil {
+		t.Fatalf("Error removing flags layer: %v", err)
+	}
+	if port := cm.GetIntOr("server.port", 0); port != 7070 {
+		t.Errorf("Expected env port 7070 after removing flags, got %d", port)
+	}
+}
@@ -0,0 +1,96 @@
+package configmanager_test
+
+import (
+	"bytes"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+// TestLoggerRedactsSecrets tests that loading, overriding and saving are logged without leaking secrets.
+func TestLoggerRedactsSecrets(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.toml")
+	testutils.ResetConfigFile(filename, []byte("[database]\nhost = \"localhost\"\npassword = \"filesecret\"\n"))
+	t.Setenv("DATABASE_PASSWORD", "envsecret")
+	t.Setenv("DATABASE_HOST", "db.internal")
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	cm := configmanager.New(configmanager.WithLogger(logger))
+
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if err := cm.LoadEnvVariables(&configmanager.DynamicConfig{Data: cm.GetData()}); err != nil {
+		t.Fatalf("Error loading env variables: %v", err)
+	}
+	if err := cm.UpdateKey("database.password", "updatedsecret"); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+
+	out := buf.String()
+	for _, expected := range []string{"loaded configuration", "applied environment override", "value=db.internal", "updated key", "saved configuration"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected log output to contain %q:\n%s", expected, out)
+		}
+	}
+	for _, secret := range []string{"filesecret", "envsecret", "updatedsecret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Log output leaks %q:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "[REDACTED]") {
+		t.Errorf("Expected redacted values in log output:\n%s", out)
+	}
+}
+
+// TestLoggerReportsFailures tests that load errors are logged.
+func TestLoggerReportsFailures(t *testing.T) {
+	var buf bytes.Buffer
+	cm := configmanager.New(configmanager.WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	if err := cm.LoadFromFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("Expected an error for a missing file")
+	}
+	if !strings.Contains(buf.String(), "level=ERROR") || !strings.Contains(buf.String(), "missing.yaml") {
+		t.Errorf("Expected the failure to be logged:\n%s", buf.String())
+	}
+}
+
+// TestLoggerRedactsNestedSecrets tests that setting a whole section does not log
+// the secrets nested in it.
+func TestLoggerRedactsNestedSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	cm := configmanager.New(configmanager.WithLogger(logger))
+
+	if err := cm.Set("database", map[string]interface{}{
+		"host":     "db.internal",
+		"password": "hunter2",
+		"replicas": []interface{}{map[string]interface{}{"host": "r1", "api_token": "tokensecret"}},
+		"auth":     map[string]string{"client_secret": "clientsecret"},
+	}); err != nil {
+		t.Fatalf("Error setting key: %v", err)
+	}
+	if err := cm.UpdateKey("database.replicas", []interface{}{map[string]interface{}{"private_key": "keysecret"}}); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+
+	out := buf.String()
+	for _, expected := range []string{"set key", "db.internal", "r1", "[REDACTED]"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected log output to contain %q:\n%s", expected, out)
+		}
+	}
+	for _, secret := range []string{"hunter2", "tokensecret", "clientsecret", "keysecret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Log output leaks %q:\n%s", secret, out)
+		}
+	}
+}
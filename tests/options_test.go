@@ -0,0 +1,111 @@
+package configmanager_test
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+// TestWithDelimiter tests keys containing dots with a custom delimiter.
+func TestWithDelimiter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "hosts.yaml")
+	testutils.ResetConfigFile(filename, []byte("hosts:\n  example.com:\n    port: 443\n"))
+
+	cm := configmanager.New(configmanager.WithDelimiter("/"))
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	testutils.AssertConfig(t, map[string]interface{}{"hosts/example.com/port": 443}, cm.GetData())
+
+	hosts, err := cm.GetStringMap("hosts")
+	if err != nil {
+		t.Fatalf("Error reading section: %v", err)
+	}
+	if _, ok := hosts["example.com"]; !ok {
+		t.Errorf("Expected example.com in %v", hosts)
+	}
+	if origin, ok := cm.Origin("hosts/example.com/port"); !ok || origin.Line != 3 {
+		t.Errorf("Unexpected origin %+v", origin)
+	}
+
+	var buf bytes.Buffer
+	if err := cm.SaveToWriter(&buf, "yaml"); err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+	if !strings.Contains(buf.String(), "example.com:") {
+		t.Errorf("Expected nested example.com key in:\n%s", buf.String())
+	}
+}
+
+// TestWithEnvPrefix tests that only prefixed environment variables override keys.
+func TestWithEnvPrefix(t *testing.T) {
+	t.Setenv("MYAPP_DATABASE_HOST", "db.internal")
+	t.Setenv("DATABASE_USER", "ignored")
+
+	cm := configmanager.New(
+		configmanager.WithEnvPrefix("myapp"),
+		configmanager.WithDefaults(map[string]interface{}{
+			"database": map[string]interface{}{"host": "localhost", "user": "dbuser"},
+		}),
+	)
+	if err := cm.LoadEnvVariables(&configmanager.DynamicConfig{Data: cm.GetData()}); err != nil {
+		t.Fatalf("Error loading env variables: %v", err)
+	}
+	expected := map[string]interface{}{
+		"database.host": "db.internal",
+		"database.user": "dbuser",
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+}
+
+// TestWithStrictKeys tests that keys missing from the defaults are rejected.
+func TestWithStrictKeys(t *testing.T) {
+	cm := configmanager.New(
+		configmanager.WithStrictKeys(),
+		configmanager.WithDefaults(map[string]interface{}{"server.port": 8080}),
+	)
+	if err := cm.LoadFromBytes([]byte(`{"server": {"port": 9090}}`), "json"); err != nil {
+		t.Fatalf("Error loading declared keys: %v", err)
+	}
+
+	err := cm.LoadFromBytes([]byte(`{"server": {"port": 9090, "prot": 1}}`), "json")
+	var ve *configmanager.ValidationError
+	if !errors.As(err, &ve) || len(ve.Errors) != 1 || ve.Errors[0].Key != "server.prot" || !errors.Is(ve.Errors[0], configmanager.ErrUnknownKey) {
+		t.Fatalf("Expected server.prot to be rejected, got %v", err)
+	}
+	if port := cm.GetIntOr("server.port", 0); port != 9090 {
+		t.Errorf("Expected port 9090 to be kept, got %d", port)
+	}
+}
+
+// TestWithDefaultFormat tests the format used for files without a recognisable format.
+func TestWithDefaultFormat(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "settings")
+
+	cm := configmanager.New(
+		configmanager.WithDefaultFormat("toml"),
+		configmanager.WithDefaults(map[string]interface{}{"name": "app"}),
+	)
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+
+	reloaded := configmanager.New()
+	if err := reloaded.LoadFromFile(filename, &configmanager.DynamicConfig{Format: "toml"}); err != nil {
+		t.Fatalf("Expected TOML content, got %v", err)
+	}
+	testutils.AssertConfig(t, map[string]interface{}{"name": "app"}, reloaded.GetData())
+
+	var buf bytes.Buffer
+	if err := cm.SaveToWriter(&buf, ""); err != nil {
+		t.Fatalf("Error saving to writer: %v", err)
+	}
+	if strings.TrimSpace(buf.String()) != `name = "app"` {
+		t.Errorf("Unexpected output:\n%s", buf.String())
+	}
+}
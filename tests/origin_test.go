@@ -0,0 +1,116 @@
+package configmanager_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+// TestOriginLineNumbers tests that each format reports the line a key was defined on.
+func TestOriginLineNumbers(t *testing.T) {
+	files := map[string]string{
+		"config.json": "{\n  \"database\": {\n    \"host\": \"localhost\",\n    \"port\": 5432\n  }\n}\n",
+		"config.yaml": "# comment\ndatabase:\n  host: localhost\n  port: 5432\n",
+		"config.toml": "# comment\n[database]\nhost = \"localhost\"\nport = 5432\n",
+		"config.ini":  "; comment\n[database]\nhost = localhost\nport = 5432\n",
+	}
+
+	dir := t.TempDir()
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(dir, name)
+			testutils.ResetConfigFile(filename, []byte(content))
+
+			cm := configmanager.New()
+			if err := cm.LoadFromFile(filename); err != nil {
+				t.Fatalf("Error loading config: %v", err)
+			}
+
+			origin, ok := cm.Origin("database.port")
+			if !ok {
+				t.Fatalf("Expected origin for database.port")
+			}
+			if origin.File != filename || origin.Line != 4 || origin.Layer != filename {
+				t.Errorf("Unexpected origin: %+v", origin)
+			}
+		})
+	}
+}
+
+// TestOriginAcrossLayers tests provenance for env and runtime overrides, and the Explain dump.
+func TestOriginAcrossLayers(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.toml")
+	testutils.ResetConfigFile(filename, []byte("[database]\nhost = \"localhost\"\nuser = \"dbuser\"\n"))
+
+	cm := configmanager.New()
+	config := &configmanager.DynamicConfig{Filename: filename}
+	if err := cm.LoadFromFile(filename, config); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	t.Setenv("DATABASE_HOST", "db.internal")
+	if err := cm.LoadEnvVariables(config); err != nil {
+		t.Fatalf("Error loading env variables: %v", err)
+	}
+	if err := cm.UpdateKey("database.user", "admin"); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+
+	if origin, _ := cm.Origin("database.host"); origin.EnvVar != "DATABASE_HOST" || origin.Layer != configmanager.LayerEnv {
+		t.Errorf("Unexpected origin for database.host: %+v", origin)
+	}
+	if origin, _ := cm.Origin("database.user"); origin.Layer != configmanager.LayerOverrides {
+		t.Errorf("Unexpected origin for database.user: %+v", origin)
+	}
+	if _, ok := cm.Origin("database.missing"); ok {
+		t.Errorf("Expected no origin for a missing key")
+	}
+
+	explain := cm.Explain()
+	for _, want := range []string{
+		"database.host = db.internal",
+		"from env DATABASE_HOST",
+		"shadows localhost from " + filename + ":2",
+		"database.user = admin",
+	} {
+		if !strings.Contains(explain, want) {
+			t.Errorf("Explain output missing %q:\n%s", want, explain)
+		}
+	}
+}
+
+// TestExplainRedactsSecrets tests that Explain hides the current and shadowed
+// values of secret keys, including secrets nested in list values.
+func TestExplainRedactsSecrets(t *testing.T) {
+	cm := configmanager.New()
+	if err := cm.SetDefaults(map[string]interface{}{
+		"database.host":     "localhost",
+		"database.password": "defaultsecret",
+		"database.replicas": []interface{}{map[string]interface{}{"host": "r1", "api_token": "tokensecret"}},
+	}); err != nil {
+		t.Fatalf("Error setting defaults: %v", err)
+	}
+	if err := cm.UpdateKey("database.password", "updatedsecret"); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+
+	explain := cm.Explain()
+	for _, want := range []string{
+		"database.host = localhost",
+		"database.password = [REDACTED]",
+		"shadows [REDACTED] from defaults",
+		"r1",
+	} {
+		if !strings.Contains(explain, want) {
+			t.Errorf("Explain output missing %q:\n%s", want, explain)
+		}
+	}
+	for _, secret := range []string{"defaultsecret", "updatedsecret", "tokensecret"} {
+		if strings.Contains(explain, secret) {
+			t.Errorf("Explain output leaks %q:\n%s", secret, explain)
+		}
+	}
+}
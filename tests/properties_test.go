@@ -0,0 +1,162 @@
+package configmanager_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/formats"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+// TestLoadPropertiesConfig tests the separators, comments, continuations and escapes of .properties files.
+func TestLoadPropertiesConfig(t *testing.T) {
+	propertiesConfig := []byte(`# Database settings
+! also a comment
+database.host=localhost
+database.port : 5432
+   database.user   dbuser
+database.password = p\=ss\:word\!
+database.url = jdbc:postgresql://localhost\
+               :5432/app
+database.greeting = caf\u00e9 \uD83D\uDE00\tend
+database.path = C:\\data\\db
+database.odd\ key = spaced
+database.literal = \#not a comment
+database.empty
+`)
+	testutils.ResetConfigFile("../config/config.properties", propertiesConfig)
+
+	cm := configmanager.New()
+	config := &formats.PropertiesConfig{}
+	if err := cm.LoadFromFile("../config/config.properties", config); err != nil {
+		t.Fatalf("Error loading properties config: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"database.host":     "localhost",
+		"database.port":     "5432",
+		"database.user":     "dbuser",
+		"database.password": "p=ss:word!",
+		"database.url":      "jdbc:postgresql://localhost:5432/app",
+		"database.greeting": "café 😀\tend",
+		"database.path":     `C:\data\db`,
+		"database.odd key":  "spaced",
+		"database.literal":  "#not a comment",
+		"database.empty":    "",
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+
+	if port := cm.GetIntOr("database.port", 0); port != 5432 {
+		t.Errorf("Expected port 5432, got %d", port)
+	}
+	if line := config.KeyLines()["database.greeting"]; line != 9 {
+		t.Errorf("Expected database.greeting on line 9, got %d", line)
+	}
+}
+
+// TestPropertiesInvalid tests that malformed escapes are rejected.
+func TestPropertiesInvalid(t *testing.T) {
+	_, err := formats.Properties.Decode([]byte("a=1\nb=\\u12G4\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected a malformed escape on line 2, got %v", err)
+	}
+}
+
+// TestPropertiesKeysBelowValues tests log4j-style files, in which a key holds a value and has keys below it.
+func TestPropertiesKeysBelowValues(t *testing.T) {
+	log4j := `log4j.rootLogger=DEBUG, A1
+log4j.appender.A1=org.apache.log4j.ConsoleAppender
+log4j.appender.A1.layout=org.apache.log4j.PatternLayout
+log4j.appender.A1.layout.ConversionPattern=%-4r [%t] %-5p %c - %m%n
+`
+	filename := filepath.Join(t.TempDir(), "log4j.properties")
+	testutils.ResetConfigFile(filename, []byte(log4j))
+
+	cm := configmanager.New(configmanager.WithEditMode())
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading properties config: %v", err)
+	}
+	expected := map[string]interface{}{
+		"log4j.rootLogger":                           "DEBUG, A1",
+		"log4j.appender.A1":                          "org.apache.log4j.ConsoleAppender",
+		"log4j.appender.A1.layout":                   "org.apache.log4j.PatternLayout",
+		"log4j.appender.A1.layout.ConversionPattern": "%-4r [%t] %-5p %c - %m%n",
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+
+	if err := cm.UpdateKey("log4j.appender.A1.layout", "org.apache.log4j.SimpleLayout"); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving properties config: %v", err)
+	}
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error reading saved config: %v", err)
+	}
+	if want := strings.Replace(log4j, "PatternLayout", "SimpleLayout", 1); string(saved) != want {
+		t.Errorf("Unexpected saved content:\n%s\nexpected:\n%s", saved, want)
+	}
+
+	rewritten := filepath.Join(t.TempDir(), "rewritten.properties")
+	if err := cm.SaveToFile(rewritten); err != nil {
+		t.Fatalf("Error saving properties config: %v", err)
+	}
+	reloaded := configmanager.New()
+	if err := reloaded.LoadFromFile(rewritten); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	testutils.AssertConfig(t, cm.GetData(), reloaded.GetData())
+
+	var conflict *configmanager.KeyConflictError
+	if err := cm.SaveToFile(filepath.Join(t.TempDir(), "log4j.json")); !errors.As(err, &conflict) {
+		t.Errorf("Expected a KeyConflictError saving to JSON, got %v", err)
+	}
+}
+
+// TestSavePropertiesConfig tests that saved values are escaped and read back unchanged.
+func TestSavePropertiesConfig(t *testing.T) {
+	cm := configmanager.New()
+	if err := cm.SetLayer(configmanager.LayerOverrides, configmanager.PriorityOverride, map[string]interface{}{
+		"database.host":     "localhost",
+		"database.port":     5432,
+		"database.password": " p=ss:#!\\",
+		"app.motd":          "café\nbar",
+		"app.tags":          []interface{}{"a", "b"},
+	}); err != nil {
+		t.Fatalf("Error setting layer: %v", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "app.properties")
+	if err := cm.SaveToFile(filename, &formats.PropertiesConfig{}); err != nil {
+		t.Fatalf("Error saving properties config: %v", err)
+	}
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error reading saved config: %v", err)
+	}
+	expected := `app.motd=caf\u00E9\nbar
+app.tags=a, b
+database.host=localhost
+database.password=\ p\=ss\:\#\!\\
+database.port=5432
+`
+	if string(saved) != expected {
+		t.Errorf("Unexpected saved content:\n%s\nexpected:\n%s", saved, expected)
+	}
+
+	reloaded := configmanager.New()
+	if err := reloaded.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	if password := reloaded.GetStringOr("database.password", ""); password != " p=ss:#!\\" {
+		t.Errorf("Expected the password to survive a round trip, got %q", password)
+	}
+	if motd := reloaded.GetStringOr("app.motd", ""); motd != "café\nbar" {
+		t.Errorf("Expected the message to survive a round trip, got %q", motd)
+	}
+}
@@ -0,0 +1,81 @@
+package configmanager_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+// TestLoadFromFS tests loading from an fs.FS, as used with embed.FS.
+func TestLoadFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"defaults/config.yaml": {Data: []byte("database:\n  host: localhost\n  port: 5432\n")},
+	}
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFS(fsys, "defaults/config.yaml"); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	expected := map[string]interface{}{
+		"database.host": "localhost",
+		"database.port": 5432,
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+
+	if origin, ok := cm.Origin("database.host"); !ok || origin.File != "defaults/config.yaml" || origin.Line != 2 {
+		t.Errorf("Unexpected origin %+v", origin)
+	}
+	if err := cm.LoadFromFS(fsys, "missing.yaml"); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+// TestLoadFromReaderAndBytes tests that in-memory sources are layered in load order.
+func TestLoadFromReaderAndBytes(t *testing.T) {
+	cm := configmanager.New()
+	if err := cm.LoadFromReader(strings.NewReader(`{"server": {"host": "0.0.0.0", "port": 8080}}`), "json"); err != nil {
+		t.Fatalf("Error loading from reader: %v", err)
+	}
+	// An empty format is detected from the content.
+	if err := cm.LoadFromBytes([]byte("[server]\nport = 9090\n"), ""); err != nil {
+		t.Fatalf("Error loading from bytes: %v", err)
+	}
+	expected := map[string]interface{}{
+		"server.host": "0.0.0.0",
+		"server.port": int64(9090),
+	}
+	testutils.AssertConfig(t, expected, cm.GetData())
+
+	if err := cm.LoadFromBytes([]byte("port = 1"), "application/x-unknown"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+// TestSaveToWriter tests serializing the configuration by format name and MIME type.
+func TestSaveToWriter(t *testing.T) {
+	cm := configmanager.New()
+	if err := cm.LoadFromBytes([]byte("database:\n  host: localhost\n"), "yaml"); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	for _, format := range []string{"toml", "application/json"} {
+		var buf bytes.Buffer
+		if err := cm.SaveToWriter(&buf, format); err != nil {
+			t.Fatalf("Error saving %s: %v", format, err)
+		}
+		reloaded := configmanager.New()
+		if err := reloaded.LoadFromReader(&buf, format); err != nil {
+			t.Fatalf("Error reloading %s: %v", format, err)
+		}
+		testutils.AssertConfig(t, map[string]interface{}{"database.host": "localhost"}, reloaded.GetData())
+	}
+
+	var buf bytes.Buffer
+	if err := cm.SaveToWriter(&buf, "nope"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
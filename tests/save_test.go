@@ -0,0 +1,172 @@
+package configmanager_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/formats"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+// TestSaveToFilePreservesMode tests that saving keeps restrictive permissions and leaves no temporary files.
+func TestSaveToFilePreservesMode(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "secrets.json")
+	testutils.ResetConfigFile(filename, []byte(`{"password": "old"}`))
+	if err := os.Chmod(filename, 0600); err != nil {
+		t.Fatalf("Error changing mode: %v", err)
+	}
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if err := cm.UpdateKey("password", "new"); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Error reading saved config: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("Expected mode 0600, got %o", mode)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the config file in %s, got %d entries", dir, len(entries))
+	}
+
+	newFile := filepath.Join(dir, "new.json")
+	if err := cm.SaveToFile(newFile); err != nil {
+		t.Fatalf("Error saving new config: %v", err)
+	}
+	if info, err := os.Stat(newFile); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("Expected new file with mode 0644, got %v (%v)", info, err)
+	}
+}
+
+// TestSaveToFileBackups tests that previous versions are rotated into .bak files.
+func TestSaveToFileBackups(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	testutils.ResetConfigFile(filename, []byte(`{"version": 0}`))
+
+	cm := configmanager.New()
+	cm.SetBackups(2)
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	for version := 1; version <= 3; version++ {
+		if err := cm.UpdateKey("version", version); err != nil {
+			t.Fatalf("Error updating key: %v", err)
+		}
+		if err := cm.SaveToFile(filename); err != nil {
+			t.Fatalf("Error saving config: %v", err)
+		}
+	}
+
+	for file, version := range map[string]int{filename: 3, filename + ".bak": 2, filename + ".bak.1": 1} {
+		saved := configmanager.New()
+		if err := saved.LoadFromFile(file, &configmanager.DynamicConfig{Format: "json"}); err != nil {
+			t.Fatalf("Error loading %s: %v", file, err)
+		}
+		if got := saved.GetIntOr("version", -1); got != version {
+			t.Errorf("Expected version %d in %s, got %d", version, file, got)
+		}
+	}
+	if _, err := os.Stat(filename + ".bak.2"); !os.IsNotExist(err) {
+		t.Errorf("Expected at most two backups, got %v", err)
+	}
+}
+
+// TestSaveToFileThroughSymlink tests that saving through a symlink replaces its target.
+func TestSaveToFileThroughSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "real.yaml")
+	link := filepath.Join(dir, "config.yaml")
+	testutils.ResetConfigFile(target, []byte("name: old\n"))
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(link); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if err := cm.UpdateKey("name", "new"); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	if err := cm.SaveToFile(link); err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected %s to remain a symlink", link)
+	}
+	reloaded := configmanager.New()
+	if err := reloaded.LoadFromFile(target); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	if name := reloaded.GetStringOr("name", ""); name != "new" {
+		t.Errorf("Expected name new, got %q", name)
+	}
+}
+
+// TestSaveConflictingKeys tests that keys holding both a value and a section are reported rather than panicking.
+func TestSaveConflictingKeys(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	testutils.ResetConfigFile(filename, []byte("a:\n  b: 1\n"))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if err := cm.SetLayer("tooling", configmanager.PriorityOverride, map[string]interface{}{"a.b.c": 2, "a.b.d": 3}); err != nil {
+		t.Fatalf("Error setting layer: %v", err)
+	}
+
+	expected := []string{"a.b", "a.b.c", "a.b.d"}
+	assertConflict := func(name string, err error) {
+		t.Helper()
+		var conflict *configmanager.KeyConflictError
+		if !errors.As(err, &conflict) {
+			t.Fatalf("%s: expected a KeyConflictError, got %v", name, err)
+		}
+		if !reflect.DeepEqual(conflict.Paths, expected) {
+			t.Errorf("%s: expected paths %v, got %v", name, expected, conflict.Paths)
+		}
+	}
+
+	assertConflict("SaveToFile", cm.SaveToFile(filename))
+	assertConflict("DynamicConfig.Save", func() error {
+		_, err := (&configmanager.DynamicConfig{Filename: filename, Data: cm.GetData()}).Save()
+		return err
+	}())
+	for name, saver := range map[string]configmanager.ConfigSaver{
+		"JSONConfig": &formats.JSONConfig{Data: cm.GetData()},
+		"YAMLConfig": &formats.YAMLConfig{Data: cm.GetData()},
+		"TOMLConfig": &formats.TOMLConfig{Data: cm.GetData()},
+	} {
+		_, err := saver.Save()
+		assertConflict(name, err)
+	}
+	var out map[string]interface{}
+	assertConflict("Unmarshal", cm.Unmarshal(&out))
+	_, err := cm.GetStringMap("a")
+	assertConflict("GetStringMap", err)
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error reading file: %v", err)
+	}
+	if string(content) != "a:\n  b: 1\n" {
+		t.Errorf("Expected the file to be left untouched, got:\n%s", content)
+	}
+}
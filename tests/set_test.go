@@ -0,0 +1,139 @@
+package configmanager_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+)
+
+// TestSetCreatesKeys tests that Set creates keys and replaces whole sections.
+func TestSetCreatesKeys(t *testing.T) {
+	cm, _ := loadChangeFixture(t)
+
+	if err := cm.Set("cache.ttl", "5m"); err != nil {
+		t.Fatalf("Error setting key: %v", err)
+	}
+	if ttl := cm.GetStringOr("cache.ttl", ""); ttl != "5m" {
+		t.Errorf("Expected cache.ttl to be 5m, got %q", ttl)
+	}
+
+	if err := cm.Set("database", map[string]interface{}{"url": "postgres://db", "pool": map[string]interface{}{"size": 10}}); err != nil {
+		t.Fatalf("Error setting section: %v", err)
+	}
+	expected := []string{"database.pool.size", "database.url"}
+	if keys := cm.Keys("database"); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected keys %v, got %v", expected, keys)
+	}
+
+	// Setting a key below a value replaces the value.
+	if err := cm.Set("server.port.tls", 8443); err != nil {
+		t.Fatalf("Error setting key: %v", err)
+	}
+	if !cm.Has("server.port.tls") || cm.GetIntOr("server.port", 0) != 0 {
+		t.Errorf("Expected server.port to be replaced by server.port.tls, got %v", cm.GetData())
+	}
+	var buf bytes.Buffer
+	if err := cm.SaveToWriter(&buf, "yaml"); err != nil {
+		t.Errorf("Error saving config: %v", err)
+	}
+}
+
+// TestDeleteKeys tests that deleted keys stay hidden until they are set again.
+func TestDeleteKeys(t *testing.T) {
+	cm, filename := loadChangeFixture(t)
+
+	if err := cm.Delete("database.port"); err != nil {
+		t.Fatalf("Error deleting key: %v", err)
+	}
+	if cm.Has("database.port") {
+		t.Errorf("Expected database.port to be deleted")
+	}
+	if err := cm.Delete("database.port"); !errors.Is(err, configmanager.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound deleting a missing key, got %v", err)
+	}
+
+	// Reloading the file does not bring the key back.
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	if cm.Has("database.port") {
+		t.Errorf("Expected database.port to stay deleted after a reload")
+	}
+
+	if err := cm.Set("database.port", 6543); err != nil {
+		t.Fatalf("Error setting key: %v", err)
+	}
+	if port := cm.GetIntOr("database.port", 0); port != 6543 {
+		t.Errorf("Expected database.port to be 6543, got %d", port)
+	}
+
+	if err := cm.DeletePrefix("database"); err != nil {
+		t.Fatalf("Error deleting prefix: %v", err)
+	}
+	if cm.Has("database") {
+		t.Errorf("Expected the database section to be deleted, got %v", cm.GetData())
+	}
+	if keys := cm.Keys(""); !reflect.DeepEqual(keys, []string{"server.port"}) {
+		t.Errorf("Expected only server.port to remain, got %v", keys)
+	}
+	if err := cm.DeletePrefix("missing"); err != nil {
+		t.Errorf("Expected no error deleting a missing prefix, got %v", err)
+	}
+}
+
+// TestDeleteNotifiesSubscribers tests that deletions are reported as removed keys.
+func TestDeleteNotifiesSubscribers(t *testing.T) {
+	cm, _ := loadChangeFixture(t)
+
+	events := make(chan configmanager.ChangeEvent, 10)
+	sub := cm.OnChange("database", func(ev configmanager.ChangeEvent) { events <- ev })
+	defer sub.Unsubscribe()
+
+	if err := cm.Delete("database.host"); err != nil {
+		t.Fatalf("Error deleting key: %v", err)
+	}
+	ev := nextEvent(t, events)
+	expected := []configmanager.Change{{Key: "database.host", Type: configmanager.ChangeRemoved, Old: "localhost"}}
+	if ev.Source != configmanager.LayerOverrides || !reflect.DeepEqual(ev.Changes, expected) {
+		t.Errorf("Unexpected event: %+v", ev)
+	}
+
+	if err := cm.Set("database.user", "admin"); err != nil {
+		t.Fatalf("Error setting key: %v", err)
+	}
+	ev = nextEvent(t, events)
+	expected = []configmanager.Change{{Key: "database.user", Type: configmanager.ChangeAdded, New: "admin"}}
+	if !reflect.DeepEqual(ev.Changes, expected) {
+		t.Errorf("Unexpected event: %+v", ev)
+	}
+}
+
+// TestSetConcurrent tests that Set and Delete may be called from several goroutines.
+func TestSetConcurrent(t *testing.T) {
+	cm := configmanager.New()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := []string{"a", "b", "c", "d", "e", "f", "g", "h"}[i]
+			for j := 0; j < 50; j++ {
+				if err := cm.Set(key, j); err != nil {
+					t.Errorf("Error setting key: %v", err)
+				}
+				_ = cm.Keys("")
+				if err := cm.Delete(key); err != nil {
+					t.Errorf("Error deleting key: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if keys := cm.Keys(""); len(keys) != 0 {
+		t.Errorf("Expected no keys, got %v", keys)
+	}
+}
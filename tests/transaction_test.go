@@ -0,0 +1,153 @@
+package configmanager_test
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1broseidon/configmanager"
+)
+
+// TestTransactionCommits tests that a transaction's changes are applied together, with a single change event.
+func TestTransactionCommits(t *testing.T) {
+	cm, _ := loadChangeFixture(t)
+
+	events := make(chan configmanager.ChangeEvent, 10)
+	sub := cm.OnChange("", func(ev configmanager.ChangeEvent) { events <- ev })
+	defer sub.Unsubscribe()
+
+	err := cm.Transaction(func(tx *configmanager.Tx) error {
+		port, err := tx.GetInt64("server.port")
+		if err != nil {
+			return err
+		}
+		if err := tx.Update("server.port", port+1); err != nil {
+			return err
+		}
+		if err := tx.Set("server.host", "0.0.0.0"); err != nil {
+			return err
+		}
+		if !tx.Has("server.host") {
+			t.Errorf("Expected the transaction to see its own writes")
+		}
+		return tx.Delete("database.port")
+	})
+	if err != nil {
+		t.Fatalf("Error running transaction: %v", err)
+	}
+
+	ev := nextEvent(t, events)
+	expected := []configmanager.Change{
+		{Key: "database.port", Type: configmanager.ChangeRemoved, Old: int64(5432)},
+		{Key: "server.host", Type: configmanager.ChangeAdded, New: "0.0.0.0"},
+		{Key: "server.port", Type: configmanager.ChangeModified, Old: int64(8080), New: int64(8081)},
+	}
+	if !reflect.DeepEqual(ev.Changes, expected) {
+		t.Errorf("Unexpected event: %+v", ev)
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("Expected a single event, also got %+v", ev)
+	default:
+	}
+}
+
+// TestTransactionTypedGetters tests that the typed getters convert values and see the transaction's own writes.
+func TestTransactionTypedGetters(t *testing.T) {
+	cm, _ := loadChangeFixture(t)
+
+	err := cm.Transaction(func(tx *configmanager.Tx) error {
+		if port, err := tx.GetInt("server.port"); err != nil || port != 8080 {
+			t.Errorf("GetInt: got %v, %v", port, err)
+		}
+		if err := tx.Set("server.timeout", "5s"); err != nil {
+			return err
+		}
+		if timeout, err := tx.GetDuration("server.timeout"); err != nil || timeout != 5*time.Second {
+			t.Errorf("GetDuration: got %v, %v", timeout, err)
+		}
+		if _, err := tx.GetBool("database.host"); err == nil {
+			t.Error("Expected a conversion error for a non-boolean value")
+		}
+		if _, err := tx.GetString("server.missing"); !errors.Is(err, configmanager.ErrKeyNotFound) {
+			t.Errorf("Expected ErrKeyNotFound, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error running transaction: %v", err)
+	}
+}
+
+// TestTransactionRollback tests that nothing is changed when the function or a validator fails.
+func TestTransactionRollback(t *testing.T) {
+	cm, _ := loadChangeFixture(t)
+	before := cm.GetData()
+
+	errAbort := errors.New("abort")
+	err := cm.Transaction(func(tx *configmanager.Tx) error {
+		if err := tx.Set("server.port", 1); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Errorf("Expected the function's error, got %v", err)
+	}
+
+	cm.AddKeyValidator("server.port", func(v interface{}) error {
+		if v == nil {
+			return errors.New("required")
+		}
+		return nil
+	})
+	err = cm.Transaction(func(tx *configmanager.Tx) error {
+		if err := tx.Set("database.host", "db1"); err != nil {
+			return err
+		}
+		return tx.DeletePrefix("server")
+	})
+	var verr *configmanager.ValidationError
+	if !errors.As(err, &verr) {
+		t.Errorf("Expected a ValidationError, got %v", err)
+	}
+
+	if after := cm.GetData(); !reflect.DeepEqual(after, before) {
+		t.Errorf("Expected the configuration to be unchanged, got %v", after)
+	}
+}
+
+// TestTransactionConcurrent tests that concurrent read-modify-write transactions do not lose updates.
+func TestTransactionConcurrent(t *testing.T) {
+	cm := configmanager.New()
+	if err := cm.Set("counter", 0); err != nil {
+		t.Fatalf("Error setting key: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				err := cm.Transaction(func(tx *configmanager.Tx) error {
+					n, err := tx.Get("counter")
+					if err != nil {
+						return err
+					}
+					return tx.Update("counter", n.(int)+1)
+				})
+				if err != nil {
+					t.Errorf("Error running transaction: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := cm.GetIntOr("counter", 0); n != 200 {
+		t.Errorf("Expected counter to be 200, got %d", n)
+	}
+}
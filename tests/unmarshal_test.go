@@ -0,0 +1,139 @@
+package configmanager_test
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+type databaseConfig struct {
+	Host     string        `config:"host"`
+	Port     int           `config:"port"`
+	Timeout  time.Duration `config:"timeout"`
+	Replicas []string      `config:"replicas"`
+	Password *string       `config:"password"`
+}
+
+type serverConfig struct {
+	Addr   net.IP
+	Port   uint16
+	Labels map[string]string `config:"labels"`
+	Ignore string            `config:"-"`
+}
+
+type appConfig struct {
+	Database databaseConfig `config:"database"`
+	Server   *serverConfig  `config:"server"`
+}
+
+// TestUnmarshal tests decoding a whole configuration into a tagged struct.
+func TestUnmarshal(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	testutils.ResetConfigFile(filename, []byte(`
+database:
+  host: localhost
+  port: 5432
+  timeout: 3s
+  replicas: [db1, db2]
+  password: secret
+server:
+  addr: 127.0.0.1
+  port: 8080
+  labels:
+    env: prod
+`))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	var cfg appConfig
+	if err := cm.Unmarshal(&cfg); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	password := "secret"
+	expected := appConfig{
+		Database: databaseConfig{
+			Host:     "localhost",
+			Port:     5432,
+			Timeout:  3 * time.Second,
+			Replicas: []string{"db1", "db2"},
+			Password: &password,
+		},
+		Server: &serverConfig{
+			Addr:   net.ParseIP("127.0.0.1"),
+			Port:   8080,
+			Labels: map[string]string{"env": "prod"},
+		},
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, cfg)
+	}
+}
+
+// TestUnmarshalKey tests decoding a single section from an INI file, where every value is a string.
+func TestUnmarshalKey(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.ini")
+	testutils.ResetConfigFile(filename, []byte("[database]\nhost = localhost\nport = 5432\ntimeout = 250ms\nreplicas = db1, db2\n"))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	var db databaseConfig
+	if err := cm.UnmarshalKey("database", &db); err != nil {
+		t.Fatalf("UnmarshalKey: %v", err)
+	}
+	if db.Host != "localhost" || db.Port != 5432 || db.Timeout != 250*time.Millisecond {
+		t.Errorf("Unexpected result: %+v", db)
+	}
+	if !reflect.DeepEqual(db.Replicas, []string{"db1", "db2"}) {
+		t.Errorf("Expected replicas [db1 db2], got %v", db.Replicas)
+	}
+
+	if err := cm.UnmarshalKey("cache", &db); !errors.Is(err, configmanager.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+// TestUnmarshalAggregatesErrors tests that every mismatched field is reported at once.
+func TestUnmarshalAggregatesErrors(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	testutils.ResetConfigFile(filename, []byte(`{"database": {"host": "localhost", "port": "not-a-number", "timeout": "forever"}}`))
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	var cfg appConfig
+	err := cm.Unmarshal(&cfg)
+	var unmarshalErr *configmanager.UnmarshalError
+	if !errors.As(err, &unmarshalErr) {
+		t.Fatalf("Expected UnmarshalError, got %v", err)
+	}
+
+	paths := map[string]bool{}
+	for _, fe := range unmarshalErr.Errors {
+		paths[fe.Path] = true
+	}
+	if len(paths) != 2 || !paths["database.port"] || !paths["database.timeout"] {
+		t.Errorf("Expected errors for database.port and database.timeout, got %v", unmarshalErr)
+	}
+	if cfg.Database.Host != "localhost" {
+		t.Errorf("Expected valid fields to be decoded, got host %q", cfg.Database.Host)
+	}
+
+	if err := cm.Unmarshal(cfg); err == nil {
+		t.Errorf("Expected error for non-pointer target")
+	}
+}
@@ -0,0 +1,123 @@
+package configmanager_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+func newValidatedManager() *configmanager.ConfigManager {
+	cm := configmanager.New()
+	cm.AddKeyValidator("server.port", func(value interface{}) error {
+		port, ok := value.(int)
+		if !ok || port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %v", value)
+		}
+		return nil
+	})
+	cm.AddKeyValidator("server.host", func(value interface{}) error {
+		if value == nil || value == "" {
+			return errors.New("host is required")
+		}
+		return nil
+	})
+	return cm
+}
+
+// TestValidatedLoadRollsBack tests that a file with bad values is rejected and the previous snapshot kept.
+func TestValidatedLoadRollsBack(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	testutils.ResetConfigFile(filename, []byte("server:\n  host: localhost\n  port: 8080\n"))
+
+	cm := newValidatedManager()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading valid config: %v", err)
+	}
+
+	testutils.ResetConfigFile(filename, []byte("server:\n  host: \"\"\n  port: 70000\n"))
+	err := cm.LoadFromFile(filename)
+	var validationErr *configmanager.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	if validationErr.Source != filename || len(validationErr.Errors) != 2 {
+		t.Errorf("Expected two failing keys from %s, got %v", filename, validationErr)
+	}
+	if !errors.Is(cm.LastReloadError(), err) {
+		t.Errorf("Expected LastReloadError to return %v, got %v", err, cm.LastReloadError())
+	}
+
+	expected := map[string]interface{}{"server.host": "localhost", "server.port": 8080}
+	testutils.AssertConfig(t, expected, cm.GetData())
+
+	testutils.ResetConfigFile(filename, []byte("server:\n  host: example.com\n  port: 9090\n"))
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading valid config: %v", err)
+	}
+	if cm.LastReloadError() != nil {
+		t.Errorf("Expected LastReloadError to be cleared, got %v", cm.LastReloadError())
+	}
+}
+
+// TestValidatedUpdateKey tests that runtime updates are validated too.
+func TestValidatedUpdateKey(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	testutils.ResetConfigFile(filename, []byte("server:\n  host: localhost\n  port: 8080\n"))
+
+	cm := newValidatedManager()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if err := cm.UpdateKey("server.port", 0); err == nil {
+		t.Fatalf("Expected validation error for port 0")
+	}
+	if port := cm.GetIntOr("server.port", 0); port != 8080 {
+		t.Errorf("Expected port to stay 8080, got %d", port)
+	}
+}
+
+// TestValidatedWatchReload tests that a hot reload with bad values is rejected and reported.
+func TestValidatedWatchReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	testutils.ResetConfigFile(filename, []byte("server:\n  host: localhost\n  port: 8080\n"))
+
+	cm := newValidatedManager()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	errs := make(chan error, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := cm.Watch(ctx, filename, configmanager.WatchOptions{
+		Interval: 5 * time.Millisecond,
+		Debounce: 10 * time.Millisecond,
+		OnError:  func(_ string, err error) { errs <- err },
+	})
+	if err != nil {
+		t.Fatalf("Error watching config: %v", err)
+	}
+
+	testutils.ResetConfigFile(filename, []byte("server:\n  host: localhost\n  port: -1\n"))
+	select {
+	case err := <-errs:
+		var validationErr *configmanager.ValidationError
+		if !errors.As(err, &validationErr) || validationErr.Errors[0].Key != "server.port" {
+			t.Errorf("Expected validation error for server.port, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for reload error")
+	}
+	if cm.LastReloadError() == nil {
+		t.Errorf("Expected LastReloadError to be set")
+	}
+	if port := cm.GetIntOr("server.port", 0); port != 8080 {
+		t.Errorf("Expected port to stay 8080, got %d", port)
+	}
+}
@@ -0,0 +1,83 @@
+package configmanager_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/1broseidon/configmanager"
+)
+
+// TestSubView tests that a view reads and writes keys relative to its prefix.
+func TestSubView(t *testing.T) {
+	cm, _ := loadChangeFixture(t)
+	db := cm.Sub("database")
+
+	if host, err := db.GetString("host"); err != nil || host != "localhost" {
+		t.Errorf("Expected host to be localhost, got %q (%v)", host, err)
+	}
+	if port := db.GetIntOr("port", 0); port != 5432 {
+		t.Errorf("Expected port to be 5432, got %d", port)
+	}
+	if keys := db.Keys(""); !reflect.DeepEqual(keys, []string{"host", "port"}) {
+		t.Errorf("Expected keys [host port], got %v", keys)
+	}
+
+	if err := db.UpdateKey("host", "db1"); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	if err := db.Set("pool.size", 10); err != nil {
+		t.Fatalf("Error setting key: %v", err)
+	}
+	if host := cm.GetStringOr("database.host", ""); host != "db1" {
+		t.Errorf("Expected the update to reach the manager, got %q", host)
+	}
+	if size := db.Sub("pool").GetIntOr("size", 0); size != 10 {
+		t.Errorf("Expected pool.size to be 10 through a nested view, got %d", size)
+	}
+
+	expected := map[string]interface{}{"host": "db1", "port": int64(5432), "pool.size": 10}
+	if data := db.GetData(); !reflect.DeepEqual(data, expected) {
+		t.Errorf("Expected data %v, got %v", expected, data)
+	}
+
+	var out struct {
+		Host string
+		Port int
+	}
+	if err := db.Unmarshal(&out); err != nil || out.Host != "db1" || out.Port != 5432 {
+		t.Errorf("Unexpected unmarshal result %+v (%v)", out, err)
+	}
+
+	if err := db.Delete("pool.size"); err != nil {
+		t.Fatalf("Error deleting key: %v", err)
+	}
+	if db.Has("pool") || cm.Has("database.pool") {
+		t.Errorf("Expected database.pool to be deleted")
+	}
+}
+
+// TestSubViewIsLive tests that a view sees later changes and reports relative keys to subscribers.
+func TestSubViewIsLive(t *testing.T) {
+	cm, _ := loadChangeFixture(t)
+	server := cm.Sub("server")
+
+	events := make(chan configmanager.ChangeEvent, 10)
+	sub := server.OnChange("", func(ev configmanager.ChangeEvent) { events <- ev })
+	defer sub.Unsubscribe()
+
+	if err := cm.UpdateKey("database.host", "db1"); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	if err := cm.UpdateKey("server.port", int64(9090)); err != nil {
+		t.Fatalf("Error updating key: %v", err)
+	}
+	if port := server.GetIntOr("port", 0); port != 9090 {
+		t.Errorf("Expected the view to see port 9090, got %d", port)
+	}
+
+	ev := nextEvent(t, events)
+	expected := []configmanager.Change{{Key: "port", Type: configmanager.ChangeModified, Old: int64(8080), New: int64(9090)}}
+	if !reflect.DeepEqual(ev.Changes, expected) {
+		t.Errorf("Unexpected event: %+v", ev)
+	}
+}
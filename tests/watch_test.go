@@ -0,0 +1,187 @@
+package configmanager_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/1broseidon/configmanager"
+	"github.com/1broseidon/configmanager/testutils"
+)
+
+var fastWatch = configmanager.WatchOptions{Interval: 5 * time.Millisecond, Debounce: 10 * time.Millisecond}
+
+// waitFor polls cond until it returns true or the test times out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func watchFile(t *testing.T, filename string, opts configmanager.WatchOptions) *configmanager.ConfigManager {
+	t.Helper()
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := cm.Watch(ctx, filename, opts); err != nil {
+		t.Fatalf("Error watching config: %v", err)
+	}
+	return cm
+}
+
+// TestWatchReloadsModifiedFile tests that in-place edits are picked up.
+func TestWatchReloadsModifiedFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	testutils.ResetConfigFile(filename, []byte("server:\n  port: 8080\n"))
+
+	var reloads int32
+	opts := fastWatch
+	opts.OnReload = func(string) { atomic.AddInt32(&reloads, 1) }
+	cm := watchFile(t, filename, opts)
+
+	testutils.ResetConfigFile(filename, []byte("server:\n  port: 9090\n"))
+	waitFor(t, "reload", func() bool { return cm.GetIntOr("server.port", 0) == 9090 })
+	if atomic.LoadInt32(&reloads) == 0 {
+		t.Errorf("Expected OnReload to be called")
+	}
+}
+
+// TestWatchRenameSave tests editors that write a temporary file and rename it over the original.
+func TestWatchRenameSave(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "config.json")
+	testutils.ResetConfigFile(filename, []byte(`{"server": {"port": 8080}}`))
+	cm := watchFile(t, filename, fastWatch)
+
+	tmp := filepath.Join(dir, ".config.json.swp")
+	testutils.ResetConfigFile(tmp, []byte(`{"server": {"port": 9090}}`))
+	if err := os.Remove(filename); err != nil {
+		t.Fatalf("Error removing config: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := os.Rename(tmp, filename); err != nil {
+		t.Fatalf("Error renaming config: %v", err)
+	}
+
+	waitFor(t, "reload", func() bool { return cm.GetIntOr("server.port", 0) == 9090 })
+}
+
+// TestWatchConfigMapSymlinkSwap tests the Kubernetes ConfigMap layout, where the
+// file is a symlink through a "..data" symlink that is atomically replaced.
+func TestWatchConfigMapSymlinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	writeVersion := func(version, content string) {
+		versionDir := filepath.Join(dir, version)
+		if err := os.Mkdir(versionDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		testutils.ResetConfigFile(filepath.Join(versionDir, "config.toml"), []byte(content))
+	}
+
+	writeVersion("..v1", "[server]\nport = 8080\n")
+	if err := os.Symlink("..v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "config.toml")
+	if err := os.Symlink(filepath.Join("..data", "config.toml"), filename); err != nil {
+		t.Fatal(err)
+	}
+	cm := watchFile(t, filename, fastWatch)
+
+	writeVersion("..v2", "[server]\nport = 9090\n")
+	if err := os.Symlink("..v2", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "reload", func() bool { return cm.GetIntOr("server.port", 0) == 9090 })
+}
+
+// TestWatchKeepsDataOnParseError tests that an unparsable file is reported and the old data kept.
+func TestWatchKeepsDataOnParseError(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	testutils.ResetConfigFile(filename, []byte(`{"server": {"port": 8080}}`))
+
+	errs := make(chan error, 10)
+	opts := fastWatch
+	opts.OnError = func(_ string, err error) { errs <- err }
+	cm := watchFile(t, filename, opts)
+
+	testutils.ResetConfigFile(filename, []byte(`{"server": `))
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for reload error")
+	}
+	if port := cm.GetIntOr("server.port", 0); port != 8080 {
+		t.Errorf("Expected previous port 8080 to be kept, got %d", port)
+	}
+}
+
+// TestWatchRejectedReloadKeepsLoader tests that a reload rejected by a validator
+// leaves the format and block labels of the loaded file in place for saving.
+func TestWatchRejectedReloadKeepsLoader(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "settings")
+	original := []byte("service \"web\" {\n  port = 80\n}\n")
+	testutils.ResetConfigFile(filename, original)
+
+	cm := configmanager.New()
+	if err := cm.LoadFromFile(filename); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	cm.AddKeyValidator("service.web.port", func(value interface{}) error {
+		if port, ok := value.(int); ok && port == 81 {
+			return errors.New("port 81 is reserved")
+		}
+		return nil
+	})
+	errs := make(chan error, 10)
+	opts := fastWatch
+	opts.OnError = func(_ string, err error) { errs <- err }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := cm.Watch(ctx, filename, opts); err != nil {
+		t.Fatalf("Error watching config: %v", err)
+	}
+
+	testutils.ResetConfigFile(filename, []byte("service:\n  web:\n    port: 81\n"))
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for the reload to be rejected")
+	}
+	cancel()
+
+	if err := cm.SaveToFile(filename); err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error reading saved config: %v", err)
+	}
+	if string(saved) != string(original) {
+		t.Errorf("Unexpected saved content:\n%s\nexpected:\n%s", saved, original)
+	}
+}
+
+// TestWatchRequiresLoadedFile tests that only files loaded through LoadFromFile can be watched.
+func TestWatchRequiresLoadedFile(t *testing.T) {
+	cm := configmanager.New()
+	if err := cm.Watch(context.Background(), "config.toml", fastWatch); err == nil {
+		t.Errorf("Expected error watching a file that was never loaded")
+	}
+}
@@ -0,0 +1,259 @@
+package configmanager
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/1broseidon/configmanager/internal"
+)
+
+// MissingKeysError is returned when keys that must already exist, such as those
+// passed to UpdateKey and UpdateKeys, do not. It matches ErrKeyNotFound.
+type MissingKeysError struct {
+	// Keys lists the missing keys, sorted.
+	Keys []string
+}
+
+// Error implements the error interface.
+func (me *MissingKeysError) Error() string {
+	if len(me.Keys) == 1 {
+		return fmt.Sprintf("key %s does not exist", me.Keys[0])
+	}
+	return fmt.Sprintf("keys %s do not exist", strings.Join(me.Keys, ", "))
+}
+
+// Is reports whether target is ErrKeyNotFound.
+func (me *MissingKeysError) Is(target error) bool {
+	return target == ErrKeyNotFound
+}
+
+// Tx is a transaction on the runtime overrides layer, passed to the function
+// given to Transaction. Reads see the transaction's own writes. A Tx must not be
+// used after that function returns or from other goroutines.
+type Tx struct {
+	cm        *ConfigManager
+	data      map[string]interface{}
+	overrides *layer
+	changed   bool
+	// logs holds the messages to log once the transaction is committed.
+	logs []func()
+}
+
+// Transaction runs fn with exclusive access to the configuration and applies
+// every change it makes at once: validators run and subscribers are notified a
+// single time, when fn returns nil. If fn returns an error, or the result is
+// rejected by a validator, nothing is changed and that error is returned.
+//
+//	err := cm.Transaction(func(tx *configmanager.Tx) error {
+//		n, err := tx.GetInt("deploy.count")
+//		if err != nil {
+//			return err
+//		}
+//		return tx.Set("deploy.count", n+1)
+//	})
+//
+// The manager stays locked while fn and the validators run, so fn must read and
+// write through tx: calling methods of cm that load, change or save the
+// configuration, such as UpdateKey, or Explain, Layers or LastReloadError,
+// deadlocks.
+func (cm *ConfigManager) Transaction(fn func(tx *Tx) error) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	tx := &Tx{cm: cm, data: cm.current().copyData(), overrides: cm.overrides()}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if !tx.changed {
+		return nil
+	}
+	if err := cm.setLayer(tx.overrides); err != nil {
+		return err
+	}
+	for _, log := range tx.logs {
+		log()
+	}
+	return nil
+}
+
+// Get returns a deep copy of the value of key as it stands in the transaction.
+func (tx *Tx) Get(key string) (interface{}, error) {
+	value, ok := tx.data[tx.cm.normalize(key)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+	return internal.Copy(value), nil
+}
+
+// GetString returns the value of key, as it stands in the transaction, converted to a string.
+func (tx *Tx) GetString(key string) (string, error) {
+	value, err := tx.Get(key)
+	if err != nil {
+		return "", err
+	}
+	s, err := internal.ToString(value)
+	if err != nil {
+		return "", convertErr(key, err)
+	}
+	return s, nil
+}
+
+// GetInt returns the value of key, as it stands in the transaction, converted to an int.
+func (tx *Tx) GetInt(key string) (int, error) {
+	value, err := tx.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	i, err := internal.ToInt(value)
+	if err != nil {
+		return 0, convertErr(key, err)
+	}
+	return i, nil
+}
+
+// GetInt64 returns the value of key, as it stands in the transaction, converted to an int64.
+func (tx *Tx) GetInt64(key string) (int64, error) {
+	value, err := tx.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	i, err := internal.ToInt64(value)
+	if err != nil {
+		return 0, convertErr(key, err)
+	}
+	return i, nil
+}
+
+// GetFloat64 returns the value of key, as it stands in the transaction, converted to a float64.
+func (tx *Tx) GetFloat64(key string) (float64, error) {
+	value, err := tx.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	f, err := internal.ToFloat64(value)
+	if err != nil {
+		return 0, convertErr(key, err)
+	}
+	return f, nil
+}
+
+// GetBool returns the value of key, as it stands in the transaction, converted to a bool.
+func (tx *Tx) GetBool(key string) (bool, error) {
+	value, err := tx.Get(key)
+	if err != nil {
+		return false, err
+	}
+	b, err := internal.ToBool(value)
+	if err != nil {
+		return false, convertErr(key, err)
+	}
+	return b, nil
+}
+
+// GetDuration returns the value of key, as it stands in the transaction, converted to a time.Duration.
+func (tx *Tx) GetDuration(key string) (time.Duration, error) {
+	value, err := tx.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	d, err := internal.ToDuration(value)
+	if err != nil {
+		return 0, convertErr(key, err)
+	}
+	return d, nil
+}
+
+// Has reports whether key holds a value or is the root of a section.
+func (tx *Tx) Has(key string) bool {
+	return hasKey(tx.data, tx.cm.normalize(key), tx.cm.delim)
+}
+
+// Keys returns, sorted, every key that equals prefix or lies below it.
+func (tx *Tx) Keys(prefix string) []string {
+	return keysUnder(tx.data, tx.cm.normalize(prefix), tx.cm.delim)
+}
+
+// Update changes the value of key, which must already exist.
+func (tx *Tx) Update(key string, value interface{}) error {
+	key = tx.cm.normalize(key)
+	if !tx.exists(key) {
+		return &MissingKeysError{Keys: []string{key}}
+	}
+	tx.put(key, value)
+	tx.debug("updated key", "key", key, valueAttr(key, value))
+	return nil
+}
+
+// Set sets key to value as ConfigManager.Set does.
+func (tx *Tx) Set(key string, value interface{}) error {
+	cm := tx.cm
+	key = cm.normalize(key)
+	f := cm.flattener()
+	f.Lists = tx.overrides.lists
+	values := f.FlattenPaths(map[string]interface{}{key: value})
+	for _, k := range keysUnder(tx.data, key, cm.delim) {
+		if _, ok := values[k]; !ok {
+			tx.remove(k)
+		}
+	}
+	segments := internal.SplitKey(key, cm.delim)
+	for i := 1; i < len(segments); i++ {
+		if parent := internal.JoinSegments(segments[:i], cm.delim); tx.exists(parent) {
+			tx.remove(parent)
+		}
+	}
+	for k, v := range values {
+		tx.put(k, v)
+	}
+	tx.debug("set key", "key", key, valueAttr(key, value))
+	return nil
+}
+
+// Delete removes key as ConfigManager.Delete does.
+func (tx *Tx) Delete(key string) error {
+	key = tx.cm.normalize(key)
+	if !tx.exists(key) {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+	tx.remove(key)
+	tx.debug("deleted key", "key", key)
+	return nil
+}
+
+// DeletePrefix removes prefix and every key below it, as ConfigManager.DeletePrefix does.
+func (tx *Tx) DeletePrefix(prefix string) error {
+	prefix = tx.cm.normalize(prefix)
+	keys := keysUnder(tx.data, prefix, tx.cm.delim)
+	for _, k := range keys {
+		tx.remove(k)
+	}
+	if len(keys) > 0 {
+		tx.debug("deleted keys", "prefix", prefix, "keys", len(keys))
+	}
+	return nil
+}
+
+func (tx *Tx) exists(key string) bool {
+	_, ok := tx.data[key]
+	return ok
+}
+
+// put stores a deep copy of value, so the caller cannot change the
+// configuration by changing value afterwards.
+func (tx *Tx) put(key string, value interface{}) {
+	value = internal.Copy(value)
+	tx.data[key] = value
+	tx.overrides.data[key] = value
+	tx.changed = true
+}
+
+func (tx *Tx) remove(key string) {
+	delete(tx.data, key)
+	tx.cm.deleteKey(tx.overrides, key)
+	tx.changed = true
+}
+
+func (tx *Tx) debug(msg string, args ...any) {
+	tx.logs = append(tx.logs, func() { tx.cm.logger.Debug(msg, args...) })
+}
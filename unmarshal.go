@@ -0,0 +1,336 @@
+package configmanager
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/1broseidon/configmanager/internal"
+)
+
+// tagName is the struct tag consulted when mapping configuration keys to struct fields.
+const tagName = "config"
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// FieldError describes a single field that could not be populated by Unmarshal.
+type FieldError struct {
+	Path string
+	Err  error
+}
+
+// Error implements the error interface.
+func (fe *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", fe.Path, fe.Err)
+}
+
+// Unwrap returns the underlying conversion error.
+func (fe *FieldError) Unwrap() error {
+	return fe.Err
+}
+
+// UnmarshalError aggregates every field that failed to decode during a single Unmarshal call.
+type UnmarshalError struct {
+	Errors []*FieldError
+}
+
+// Error implements the error interface.
+func (ue *UnmarshalError) Error() string {
+	msgs := make([]string, len(ue.Errors))
+	for i, fe := range ue.Errors {
+		msgs[i] = fe.Error()
+	}
+	return fmt.Sprintf("failed to unmarshal %d field(s): %s", len(ue.Errors), strings.Join(msgs, "; "))
+}
+
+// Unmarshal decodes the whole configuration into out, which must be a non-nil pointer.
+// Struct fields are matched using the `config:"name"` tag, falling back to a
+// case-insensitive match on the field name. A tag of "-" skips the field.
+func (cm *ConfigManager) Unmarshal(out interface{}) error {
+	s := cm.current()
+	f := cm.flattener()
+	f.Lists = s.lists
+	data, err := f.Unflatten(internal.CopyMap(s.data))
+	if err != nil {
+		return err
+	}
+	return decodeInto("", data, out)
+}
+
+// UnmarshalKey decodes the value or section rooted at key into out, which must be a non-nil pointer.
+func (cm *ConfigManager) UnmarshalKey(key string, out interface{}) error {
+	value, err := cm.section(key)
+	if err != nil {
+		return err
+	}
+	return decodeInto(key, value, out)
+}
+
+// decodeInto validates out and runs the decoder, collecting field errors.
+func decodeInto(path string, input interface{}, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("unmarshal target must be a non-nil pointer, got %T", out)
+	}
+
+	d := &decoder{}
+	d.decode(path, input, rv.Elem())
+	if len(d.errors) > 0 {
+		return &UnmarshalError{Errors: d.errors}
+	}
+	return nil
+}
+
+// decoder walks unflattened configuration data into Go values.
+type decoder struct {
+	errors []*FieldError
+}
+
+func (d *decoder) fail(path string, err error) {
+	if path == "" {
+		path = "."
+	}
+	d.errors = append(d.errors, &FieldError{Path: path, Err: err})
+}
+
+func (d *decoder) decode(path string, input interface{}, out reflect.Value) {
+	if input == nil {
+		return
+	}
+
+	if out.Type() == durationType {
+		dur, err := internal.ToDuration(input)
+		if err != nil {
+			d.fail(path, err)
+			return
+		}
+		out.SetInt(int64(dur))
+		return
+	}
+
+	if out.CanAddr() && out.Addr().Type().Implements(textUnmarshalerType) {
+		if s, ok := input.(string); ok {
+			if err := out.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+				d.fail(path, err)
+			}
+			return
+		}
+	}
+
+	switch out.Kind() {
+	case reflect.Ptr:
+		if out.IsNil() {
+			out.Set(reflect.New(out.Type().Elem()))
+		}
+		d.decode(path, input, out.Elem())
+	case reflect.Interface:
+		value := reflect.ValueOf(input)
+		if !value.Type().AssignableTo(out.Type()) {
+			d.fail(path, fmt.Errorf("cannot assign %T to %s", input, out.Type()))
+			return
+		}
+		out.Set(value)
+	case reflect.Struct:
+		d.decodeStruct(path, input, out)
+	case reflect.Map:
+		d.decodeMap(path, input, out)
+	case reflect.Slice:
+		d.decodeSlice(path, input, out)
+	case reflect.Array:
+		d.decodeArray(path, input, out)
+	case reflect.String:
+		s, err := internal.ToString(input)
+		if err != nil {
+			d.fail(path, err)
+			return
+		}
+		out.SetString(s)
+	case reflect.Bool:
+		b, err := internal.ToBool(input)
+		if err != nil {
+			d.fail(path, err)
+			return
+		}
+		out.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := internal.ToInt64(input)
+		if err != nil {
+			d.fail(path, err)
+			return
+		}
+		if out.OverflowInt(i) {
+			d.fail(path, fmt.Errorf("value %d overflows %s", i, out.Type()))
+			return
+		}
+		out.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := internal.ToInt64(input)
+		if err != nil {
+			d.fail(path, err)
+			return
+		}
+		if i < 0 || out.OverflowUint(uint64(i)) {
+			d.fail(path, fmt.Errorf("value %d overflows %s", i, out.Type()))
+			return
+		}
+		out.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		f, err := internal.ToFloat64(input)
+		if err != nil {
+			d.fail(path, err)
+			return
+		}
+		if out.OverflowFloat(f) {
+			d.fail(path, fmt.Errorf("value %v overflows %s", f, out.Type()))
+			return
+		}
+		out.SetFloat(f)
+	default:
+		d.fail(path, fmt.Errorf("unsupported field type %s", out.Type()))
+	}
+}
+
+func (d *decoder) decodeStruct(path string, input interface{}, out reflect.Value) {
+	m, err := internal.ToStringMap(input)
+	if err != nil {
+		d.fail(path, err)
+		return
+	}
+
+	rt := out.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, tagged := field.Tag.Lookup(tagName)
+		name = strings.Split(name, ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		// Untagged embedded structs share their parent's keys.
+		if field.Anonymous && !tagged && indirectType(field.Type).Kind() == reflect.Struct {
+			d.decode(path, m, out.Field(i))
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		value, ok := lookupField(m, name, !tagged)
+		if !ok {
+			continue
+		}
+		d.decode(joinPath(path, name), value, out.Field(i))
+	}
+}
+
+func (d *decoder) decodeMap(path string, input interface{}, out reflect.Value) {
+	m, err := internal.ToStringMap(input)
+	if err != nil {
+		d.fail(path, err)
+		return
+	}
+
+	rt := out.Type()
+	if rt.Key().Kind() != reflect.String {
+		d.fail(path, fmt.Errorf("unsupported map key type %s", rt.Key()))
+		return
+	}
+	if out.IsNil() {
+		out.Set(reflect.MakeMapWithSize(rt, len(m)))
+	}
+	for k, v := range m {
+		elem := reflect.New(rt.Elem()).Elem()
+		d.decode(joinPath(path, k), v, elem)
+		out.SetMapIndex(reflect.ValueOf(k).Convert(rt.Key()), elem)
+	}
+}
+
+func (d *decoder) decodeSlice(path string, input interface{}, out reflect.Value) {
+	items, ok := sliceItems(input)
+	if !ok {
+		d.fail(path, fmt.Errorf("cannot convert %T to %s", input, out.Type()))
+		return
+	}
+
+	slice := reflect.MakeSlice(out.Type(), len(items), len(items))
+	for i, item := range items {
+		d.decode(fmt.Sprintf("%s[%d]", path, i), item, slice.Index(i))
+	}
+	out.Set(slice)
+}
+
+func (d *decoder) decodeArray(path string, input interface{}, out reflect.Value) {
+	items, ok := sliceItems(input)
+	if !ok {
+		d.fail(path, fmt.Errorf("cannot convert %T to %s", input, out.Type()))
+		return
+	}
+	if len(items) > out.Len() {
+		d.fail(path, fmt.Errorf("%d elements do not fit in %s", len(items), out.Type()))
+		return
+	}
+	for i, item := range items {
+		d.decode(fmt.Sprintf("%s[%d]", path, i), item, out.Index(i))
+	}
+}
+
+// sliceItems returns the elements of a decoded array. Plain strings, as produced
+// by INI files and environment variables, are split on commas.
+func sliceItems(input interface{}) ([]interface{}, bool) {
+	if s, ok := input.(string); ok {
+		parts, _ := internal.ToStringSlice(s)
+		items := make([]interface{}, len(parts))
+		for i, p := range parts {
+			items[i] = p
+		}
+		return items, true
+	}
+
+	rv := reflect.ValueOf(input)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	items := make([]interface{}, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+	return items, true
+}
+
+// lookupField finds name in m, optionally ignoring case.
+func lookupField(m map[string]interface{}, name string, fold bool) (interface{}, bool) {
+	if value, ok := m[name]; ok {
+		return value, true
+	}
+	if fold {
+		for k, v := range m {
+			if strings.EqualFold(k, name) {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
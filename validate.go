@@ -0,0 +1,146 @@
+package configmanager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownKey is reported for keys that are not declared by the defaults layer when strict keys are enabled.
+var ErrUnknownKey = errors.New("unknown key")
+
+// Validator checks a candidate merged configuration before it replaces the
+// current one. To report several failing keys at once, return a
+// *ValidationError or a *KeyError; any other error is reported without a key.
+// Validators must not modify data. They run while the manager is locked, so
+// they may use its getters but must not call methods that load, change or save
+// the configuration, nor Explain, Layers or LastReloadError, which would
+// deadlock.
+type Validator func(data map[string]interface{}) error
+
+// KeyError describes a single key that failed validation.
+type KeyError struct {
+	Key string
+	Err error
+}
+
+// Error implements the error interface.
+func (ke *KeyError) Error() string {
+	if ke.Key == "" {
+		return ke.Err.Error()
+	}
+	return fmt.Sprintf("%s: %v", ke.Key, ke.Err)
+}
+
+// Unwrap returns the underlying validation error.
+func (ke *KeyError) Unwrap() error {
+	return ke.Err
+}
+
+// ValidationError is returned when a candidate configuration is rejected by one
+// or more validators. The previous configuration is kept in that case.
+type ValidationError struct {
+	// Source is the name of the layer whose update was rejected.
+	Source string
+	Errors []*KeyError
+}
+
+// Error implements the error interface.
+func (ve *ValidationError) Error() string {
+	msgs := make([]string, len(ve.Errors))
+	for i, ke := range ve.Errors {
+		msgs[i] = ke.Error()
+	}
+	return fmt.Sprintf("validation of %s failed: %s", ve.Source, strings.Join(msgs, "; "))
+}
+
+// AddValidator registers v to run against every candidate configuration before it is applied.
+func (cm *ConfigManager) AddValidator(v Validator) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.validators = append(cm.validators, v)
+}
+
+// AddKeyValidator registers fn to validate the value of a single key. fn
+// receives nil when the key is missing from the candidate configuration.
+func (cm *ConfigManager) AddKeyValidator(key string, fn func(value interface{}) error) {
+	key = cm.normalize(key)
+	cm.AddValidator(func(data map[string]interface{}) error {
+		if err := fn(data[key]); err != nil {
+			return &KeyError{Key: key, Err: err}
+		}
+		return nil
+	})
+}
+
+// LastReloadError returns the error from the most recent file load or reload,
+// or nil if it succeeded.
+func (cm *ConfigManager) LastReloadError() error {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.lastReloadErr
+}
+
+// setLastReloadError records err as the outcome of the most recent reload.
+func (cm *ConfigManager) setLastReloadError(err error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.lastReloadErr = err
+}
+
+// validate runs every validator against candidate. The caller must hold cm.mu.
+func (cm *ConfigManager) validate(source string, candidate map[string]interface{}) error {
+	failures := cm.unknownKeys(candidate)
+	for _, v := range cm.validators {
+		err := v(candidate)
+		if err == nil {
+			continue
+		}
+
+		var ve *ValidationError
+		var ke *KeyError
+		switch {
+		case errors.As(err, &ve):
+			failures = append(failures, ve.Errors...)
+		case errors.As(err, &ke):
+			failures = append(failures, ke)
+		default:
+			failures = append(failures, &KeyError{Err: err})
+		}
+	}
+
+	if len(failures) > 0 {
+		return &ValidationError{Source: source, Errors: failures}
+	}
+	return nil
+}
+
+// unknownKeys reports the keys of candidate that are not declared by the
+// defaults layer, in sorted order, if strict keys are enabled. The caller must hold cm.mu.
+func (cm *ConfigManager) unknownKeys(candidate map[string]interface{}) []*KeyError {
+	if !cm.strict {
+		return nil
+	}
+	var declared map[string]interface{}
+	if defaults, ok := cm.layers[LayerDefaults]; ok {
+		declared = defaults.data
+	}
+
+	var unknown []string
+	for k := range candidate {
+		if _, ok := declared[k]; !ok {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+
+	failures := make([]*KeyError, 0, len(unknown))
+	for _, k := range unknown {
+		failures = append(failures, &KeyError{Key: k, Err: ErrUnknownKey})
+	}
+	return failures
+}
@@ -0,0 +1,220 @@
+package configmanager
+
+import (
+	"strings"
+	"time"
+
+	"github.com/1broseidon/configmanager/internal"
+)
+
+// View is a live view of the section of a ConfigManager rooted at a prefix,
+// returned by Sub. Its methods take and return keys relative to the prefix, so
+// that a subsystem handed Sub("database") reads "host" rather than
+// "database.host". A View holds no data of its own: reads always see the
+// manager's current configuration, and writes go through the manager, sharing
+// its locking, validation and change notifications.
+type View struct {
+	cm     *ConfigManager
+	prefix string
+}
+
+// Sub returns a view of the section rooted at prefix. The section need not
+// exist yet; keys set through the view are created below prefix.
+func (cm *ConfigManager) Sub(prefix string) *View {
+	return &View{cm: cm, prefix: cm.normalize(strings.TrimSuffix(prefix, cm.delim))}
+}
+
+// Sub returns a view of the section rooted at prefix within this view.
+func (v *View) Sub(prefix string) *View {
+	return &View{cm: v.cm, prefix: v.key(strings.TrimSuffix(prefix, v.cm.delim))}
+}
+
+// Prefix returns the full key of the section the view is rooted at.
+func (v *View) Prefix() string {
+	return v.prefix
+}
+
+// key returns the full key of a key relative to the view.
+func (v *View) key(key string) string {
+	key = v.cm.normalize(key)
+	switch {
+	case v.prefix == "":
+		return key
+	case key == "":
+		return v.prefix
+	default:
+		return v.prefix + v.cm.delim + key
+	}
+}
+
+// relative returns key relative to the view.
+func (v *View) relative(key string) string {
+	if v.prefix == "" {
+		return key
+	}
+	if key == v.prefix {
+		return ""
+	}
+	return strings.TrimPrefix(key, v.prefix+v.cm.delim)
+}
+
+// GetData returns a deep copy of the section's flattened data, keyed relative to the view.
+func (v *View) GetData() map[string]interface{} {
+	data := v.cm.current().data
+	section := make(map[string]interface{})
+	for _, k := range keysUnder(data, v.prefix, v.cm.delim) {
+		section[v.relative(k)] = internal.Copy(data[k])
+	}
+	return section
+}
+
+// Has reports whether key holds a value or is the root of a section.
+func (v *View) Has(key string) bool {
+	return v.cm.Has(v.key(key))
+}
+
+// Keys returns, sorted and relative to the view, every key that equals prefix
+// or lies below it. An empty prefix returns every key of the section.
+func (v *View) Keys(prefix string) []string {
+	keys := v.cm.Keys(v.key(prefix))
+	for i, k := range keys {
+		keys[i] = v.relative(k)
+	}
+	return keys
+}
+
+// GetString returns the value of key converted to a string.
+func (v *View) GetString(key string) (string, error) {
+	return v.cm.GetString(v.key(key))
+}
+
+// GetInt returns the value of key converted to an int.
+func (v *View) GetInt(key string) (int, error) {
+	return v.cm.GetInt(v.key(key))
+}
+
+// GetInt64 returns the value of key converted to an int64.
+func (v *View) GetInt64(key string) (int64, error) {
+	return v.cm.GetInt64(v.key(key))
+}
+
+// GetFloat64 returns the value of key converted to a float64.
+func (v *View) GetFloat64(key string) (float64, error) {
+	return v.cm.GetFloat64(v.key(key))
+}
+
+// GetBool returns the value of key converted to a bool.
+func (v *View) GetBool(key string) (bool, error) {
+	return v.cm.GetBool(v.key(key))
+}
+
+// GetDuration returns the value of key converted to a time.Duration.
+func (v *View) GetDuration(key string) (time.Duration, error) {
+	return v.cm.GetDuration(v.key(key))
+}
+
+// GetStringSlice returns the value of key converted to a slice of strings.
+func (v *View) GetStringSlice(key string) ([]string, error) {
+	return v.cm.GetStringSlice(v.key(key))
+}
+
+// GetStringMap returns the section rooted at key as a nested map.
+func (v *View) GetStringMap(key string) (map[string]interface{}, error) {
+	return v.cm.GetStringMap(v.key(key))
+}
+
+// GetStringOr returns the value of key as a string, or def if the key is missing or cannot be converted.
+func (v *View) GetStringOr(key string, def string) string {
+	return v.cm.GetStringOr(v.key(key), def)
+}
+
+// GetIntOr returns the value of key as an int, or def if the key is missing or cannot be converted.
+func (v *View) GetIntOr(key string, def int) int {
+	return v.cm.GetIntOr(v.key(key), def)
+}
+
+// GetInt64Or returns the value of key as an int64, or def if the key is missing or cannot be converted.
+func (v *View) GetInt64Or(key string, def int64) int64 {
+	return v.cm.GetInt64Or(v.key(key), def)
+}
+
+// GetFloat64Or returns the value of key as a float64, or def if the key is missing or cannot be converted.
+func (v *View) GetFloat64Or(key string, def float64) float64 {
+	return v.cm.GetFloat64Or(v.key(key), def)
+}
+
+// GetBoolOr returns the value of key as a bool, or def if the key is missing or cannot be converted.
+func (v *View) GetBoolOr(key string, def bool) bool {
+	return v.cm.GetBoolOr(v.key(key), def)
+}
+
+// GetDurationOr returns the value of key as a time.Duration, or def if the key is missing or cannot be converted.
+func (v *View) GetDurationOr(key string, def time.Duration) time.Duration {
+	return v.cm.GetDurationOr(v.key(key), def)
+}
+
+// GetStringSliceOr returns the value of key as a slice of strings, or def if the key is missing or cannot be converted.
+func (v *View) GetStringSliceOr(key string, def []string) []string {
+	return v.cm.GetStringSliceOr(v.key(key), def)
+}
+
+// GetStringMapOr returns the section rooted at key as a nested map, or def if the key is missing or cannot be converted.
+func (v *View) GetStringMapOr(key string, def map[string]interface{}) map[string]interface{} {
+	return v.cm.GetStringMapOr(v.key(key), def)
+}
+
+// Unmarshal decodes the whole section into out, as ConfigManager.Unmarshal does.
+func (v *View) Unmarshal(out interface{}) error {
+	if v.prefix == "" {
+		return v.cm.Unmarshal(out)
+	}
+	return v.cm.UnmarshalKey(v.prefix, out)
+}
+
+// UnmarshalKey decodes the value or section rooted at key into out.
+func (v *View) UnmarshalKey(key string, out interface{}) error {
+	return v.cm.UnmarshalKey(v.key(key), out)
+}
+
+// UpdateKey updates a specific key, which must already exist.
+func (v *View) UpdateKey(key string, value interface{}) error {
+	return v.cm.UpdateKey(v.key(key), value)
+}
+
+// UpdateKeys updates multiple keys at once, as ConfigManager.UpdateKeys does.
+func (v *View) UpdateKeys(updates map[string]interface{}) error {
+	full := make(map[string]interface{}, len(updates))
+	for k, value := range updates {
+		full[v.key(k)] = value
+	}
+	return v.cm.UpdateKeys(full)
+}
+
+// Set sets key to value, creating the key if it does not exist, as ConfigManager.Set does.
+func (v *View) Set(key string, value interface{}) error {
+	return v.cm.Set(v.key(key), value)
+}
+
+// Delete removes key, as ConfigManager.Delete does.
+func (v *View) Delete(key string) error {
+	return v.cm.Delete(v.key(key))
+}
+
+// DeletePrefix removes prefix and every key below it. An empty prefix removes the whole section.
+func (v *View) DeletePrefix(prefix string) error {
+	return v.cm.DeletePrefix(v.key(prefix))
+}
+
+// OnChange registers fn to be called whenever a key under prefix, relative to
+// the view, changes. The keys of the changes fn receives are relative to the view.
+func (v *View) OnChange(prefix string, fn func(ChangeEvent)) *Subscription {
+	return v.cm.OnChange(v.key(strings.TrimSuffix(strings.TrimSuffix(prefix, "*"), v.cm.delim)), func(ev ChangeEvent) {
+		changes := make([]Change, len(ev.Changes))
+		for i, c := range ev.Changes {
+			c.Key = v.relative(c.Key)
+			changes[i] = c
+		}
+		ev.Changes = changes
+		fn(ev)
+	})
+}
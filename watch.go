@@ -0,0 +1,181 @@
+package configmanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// Default polling settings used by Watch when WatchOptions leaves them unset.
+const (
+	DefaultWatchInterval = time.Second
+	DefaultWatchDebounce = 100 * time.Millisecond
+)
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	// Interval is how often the file is polled. Defaults to DefaultWatchInterval.
+	Interval time.Duration
+	// Debounce is how long a changed file must stay unchanged before it is
+	// reloaded, so that editors writing in several steps trigger a single reload.
+	// Defaults to DefaultWatchDebounce; a negative value disables debouncing.
+	Debounce time.Duration
+	// OnReload, if set, is called after the file has been reloaded successfully.
+	OnReload func(filename string)
+	// OnError, if set, is called when the changed file cannot be read, parsed or
+	// validated. The previously loaded data is kept in that case, and the error
+	// is also available from LastReloadError.
+	OnError func(filename string, err error)
+}
+
+// fileState fingerprints a watched file. The resolved path catches symlink swaps
+// such as Kubernetes ConfigMap "..data" updates, and the hash catches edits that
+// leave the size and modification time unchanged.
+type fileState struct {
+	path    string
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+// Watch polls filename, which must previously have been loaded with
+// LoadFromFile, and reloads it with a copy of the same ConfigLoader whenever its
+// content changes. The reloaded data atomically replaces the file's layer, and
+// the copy replaces the loader; a document that fails to parse or validate
+// changes neither. Watch returns immediately; polling stops when ctx is cancelled.
+//
+// A file that is temporarily missing, as happens when an editor saves by
+// writing a new file and renaming it into place, is skipped until it reappears.
+func (cm *ConfigManager) Watch(ctx context.Context, filename string, opts WatchOptions) error {
+	cm.mu.RLock()
+	l, ok := cm.layers[filename]
+	cm.mu.RUnlock()
+	if !ok || l.filename == "" || l.fromFS {
+		return fmt.Errorf("file %s has not been loaded with LoadFromFile", filename)
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultWatchInterval
+	}
+	if opts.Debounce == 0 {
+		opts.Debounce = DefaultWatchDebounce
+	}
+
+	current, _, err := readFileState(filename)
+	if err != nil {
+		return fmt.Errorf("failed to watch file %s: %w", filename, err)
+	}
+
+	go cm.watch(ctx, filename, current, opts)
+	return nil
+}
+
+// watch is the polling loop started by Watch.
+func (cm *ConfigManager) watch(ctx context.Context, filename string, current fileState, opts WatchOptions) {
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	var pending *fileState
+	var pendingSince time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		state, data, err := readFileState(filename)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				cm.setLastReloadError(err)
+				cm.logger.Warn("failed to read watched file", "file", filename, "error", err)
+				if opts.OnError != nil {
+					opts.OnError(filename, err)
+				}
+			}
+			continue
+		}
+
+		if state == current {
+			pending = nil
+			continue
+		}
+		if pending == nil || state != *pending {
+			pending = &state
+			pendingSince = time.Now()
+		}
+		if time.Since(pendingSince) < opts.Debounce {
+			continue
+		}
+
+		current = state
+		pending = nil
+		if err := cm.reloadFile(filename, data); err != nil {
+			cm.logger.Warn("failed to reload configuration", "file", filename, "error", err)
+			if opts.OnError != nil {
+				opts.OnError(filename, err)
+			}
+			continue
+		}
+		cm.logger.Info("reloaded configuration", "file", filename)
+		if opts.OnReload != nil {
+			opts.OnReload(filename)
+		}
+	}
+}
+
+// reloadFile re-parses data with a copy of the loader originally used for
+// filename and swaps in the result. The copy only replaces the loader once the
+// new data is accepted, so a rejected document leaves the format, block labels
+// and arrays recorded by the loader for saving as they were.
+func (cm *ConfigManager) reloadFile(filename string, data []byte) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	l, ok := cm.layers[filename]
+	if !ok || l.filename == "" || l.fromFS {
+		return fmt.Errorf("file %s is no longer loaded", filename)
+	}
+	return cm.loadLayer(&layer{name: filename, filename: filename}, cloneLoader(l.loader), data)
+}
+
+// cloneLoader returns a shallow copy of loader, keeping its settings, if it is
+// a pointer to a struct, as every loader in this module is. Other loaders are
+// returned as they are.
+func cloneLoader(loader ConfigLoader) ConfigLoader {
+	rv := reflect.ValueOf(loader)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return loader
+	}
+	clone := reflect.New(rv.Elem().Type())
+	clone.Elem().Set(rv.Elem())
+	return clone.Interface().(ConfigLoader)
+}
+
+// readFileState reads filename and returns its fingerprint along with its content.
+func readFileState(filename string) (fileState, []byte, error) {
+	resolved, err := filepath.EvalSymlinks(filename)
+	if err != nil {
+		return fileState{}, nil, err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return fileState{}, nil, err
+	}
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		return fileState{}, nil, err
+	}
+	return fileState{
+		path:    resolved,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		hash:    sha256.Sum256(data),
+	}, data, nil
+}